@@ -4,23 +4,91 @@ import (
 	"database/sql"
 	"errors"
 	"log"
+	"time"
 
 	"net/http"
 
 	"github.com/Mictrlan/Miuer/admin/model/mysql"
+	"github.com/Mictrlan/Miuer/admin/utility"
+	audit "github.com/Mictrlan/Miuer/audit/controller/gin"
+	services "github.com/Mictrlan/Miuer/smsservice/services"
 
+	ginjwt "github.com/appleboy/gin-jwt"
 	"github.com/gin-gonic/gin"
 )
 
 // AdminController -
 type AdminController struct {
-	db *sql.DB
+	db     *sql.DB
+	authMW *ginjwt.GinJWTMiddleware
+	getUID func(ctx *gin.Context) (uint32, error)
+
+	// RefreshTimeout is the lifetime of a refresh token, each refresh starts a new lifetime
+	RefreshTimeout time.Duration
+
+	// LockoutPolicy controls backoff and lockout of failed logins
+	LockoutPolicy mysql.LockoutPolicy
+
+	// SMSConf is used to send verification code of password reset
+	SMSConf *services.Config
+
+	// ResetTimeout is the lifetime of a password reset ticket
+	ResetTimeout time.Duration
+
+	// ResetCodeTTL is the lifetime of a password reset code sent by sms
+	ResetCodeTTL time.Duration
+
+	// PwdPolicy validates every new password
+	PwdPolicy utility.PasswordValidator
+
+	// PwdHistory is the number of recent passwords that can't be reused
+	PwdHistory int
+
+	// RequirePermission return a middleware that only lets the admins granted the named permission through,
+	// it gates the endpoints that manage other admins
+	RequirePermission func(name string) gin.HandlerFunc
+
+	// CanImpersonate return an error unless actor may act as target without gaining any access,
+	// e.g. every role of target is a role of actor and target keeps every deny rule of actor.
+	// It is required by RegisterRouter.
+	CanImpersonate func(actor, target uint32) error
+
+	// InviteTimeout is the lifetime of an invitation
+	InviteTimeout time.Duration
+
+	// Keys signs and verifies access tokens with asymmetric keys identified by kid,
+	// the key of the jwt middleware is used when it is nil
+	Keys *utility.KeySet
+
+	// TokenClaims return the extra claims of the access tokens of an admin, e.g. its roles.
+	// The claims of the admin controller are never replaced, and a token is issued without
+	// the extra claims when it fails. It is optional.
+	TokenClaims func(aid uint32) (map[string]interface{}, error)
 }
 
+// ManagePermission is the named permission required to manage other admins
+const ManagePermission = "admin:manage"
+
 // New create new AdminController
 func New(db *sql.DB) *AdminController {
 	return &AdminController{
-		db: db,
+		db:             db,
+		RefreshTimeout: 7 * 24 * time.Hour,
+		LockoutPolicy: mysql.LockoutPolicy{
+			MaxFailures: 5,
+			Backoff:     time.Second,
+			Lockout:     15 * time.Minute,
+			Window:      time.Hour,
+		},
+		ResetTimeout:  15 * time.Minute,
+		ResetCodeTTL:  10 * time.Minute,
+		InviteTimeout: 72 * time.Hour,
+		PwdPolicy: &utility.PasswordPolicy{
+			MinLength:    8,
+			MaxLength:    utility.MaxPasswordBytes,
+			RequireDigit: true,
+		},
+		PwdHistory: 5,
 	}
 }
 
@@ -28,6 +96,8 @@ var (
 	errServerNotExists = errors.New("[RegisterRouter]: server is nil")
 	errPwdRepeat       = errors.New("the new password can't be the same as the old password")
 	errPwdDisagree     = errors.New("the new password and confirming password disagree")
+	errNoPermissionMW  = errors.New("[RegisterRouter]: RequirePermission is nil")
+	errNoImpersonateMW = errors.New("[RegisterRouter]: CanImpersonate is nil")
 )
 
 // RegisterRouter register admin router
@@ -36,6 +106,14 @@ func (ac *AdminController) RegisterRouter(r gin.IRouter) {
 		log.Fatal(errServerNotExists)
 	}
 
+	if ac.RequirePermission == nil {
+		log.Fatal(errNoPermissionMW)
+	}
+
+	if ac.CanImpersonate == nil {
+		log.Fatal(errNoImpersonateMW)
+	}
+
 	err := mysql.CreateDataBase(ac.db)
 	if err != nil {
 		log.Fatal(err)
@@ -46,54 +124,76 @@ func (ac *AdminController) RegisterRouter(r gin.IRouter) {
 		log.Fatal(err)
 	}
 
-	r.POST("/api/v1/admin/create", ac.create)
-	r.POST("/api/v1/admin/modifyEmail", ac.modifyEmail)
-	r.POST("/api/v1/admin/modifyMobile", ac.modifyMobile)
-	r.POST("/api/v1/admin/modifyPwd", ac.modifyPwd)
-	r.POST("/api/v1/admin/modifyActive", ac.modifyActive)
+	err = mysql.CreateSessionTable(ac.db)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-}
+	err = mysql.CreateTOTPTable(ac.db)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-// Create create staff information
-func (ac *AdminController) create(ctx *gin.Context) {
-	var admin struct {
-		Name   string `json:"name"      binding:"required,alphanum,min=2,max=30"`
-		Pwd    string `json:"pwd"       binding:"printascii,min=6,max=30"`
-		Mobile string `json:"mobile"    binding:"required,numeric,len=11"`
-		Email  string `json:"email"     binding:"required,email"`
+	err = mysql.CreateLockoutTable(ac.db)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-		PwdConf string
+	err = mysql.CreateHistoryTable(ac.db)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	err := ctx.ShouldBind(&admin)
+	err = mysql.CreatePwdHistoryTable(ac.db)
 	if err != nil {
-		ctx.Error(err)
-		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
-		return
+		log.Fatal(err)
 	}
 
-	if admin.Pwd != admin.PwdConf {
-		ctx.Error(errPwdDisagree)
-		ctx.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict})
-		return
+	err = mysql.CreateAPIKeyTable(ac.db)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	err = mysql.Create(ac.db, admin.Name, admin.Pwd, admin.Mobile, admin.Email)
+	err = mysql.CreateInviteTable(ac.db)
 	if err != nil {
-		ctx.Error(err)
-		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
-		return
+		log.Fatal(err)
+	}
+
+	err = mysql.CreateImpersonationTable(ac.db)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	ctx.JSON(http.StatusCreated, gin.H{"status": http.StatusCreated})
+	r.POST("/api/v1/admin/impersonate", ac.RequirePermission(ImpersonatePermission), ac.impersonate)
+
+	manage := r.Group("", ac.RequirePermission(ManagePermission))
+
+	manage.POST("/api/v1/admin/modifyEmail", ac.modifyEmail)
+	manage.POST("/api/v1/admin/modifyMobile", ac.modifyMobile)
+	manage.POST("/api/v1/admin/modifyPwd", ac.modifyPwd)
+	manage.POST("/api/v1/admin/modifyActive", ac.modifyActive)
+	manage.POST("/api/v1/admin/list", ac.list)
+	manage.POST("/api/v1/admin/info", ac.info)
+	manage.POST("/api/v1/admin/history", ac.history)
+	manage.POST("/api/v1/admin/history/newip", ac.newIPLogins)
+
+	manage.POST("/api/v1/admin/locks", ac.listLoginLocks)
+	manage.POST("/api/v1/admin/unlock", ac.clearLoginLock)
+
+	manage.POST("/api/v1/admin/invite/create", ac.createInvite)
+	manage.POST("/api/v1/admin/invite/list", ac.listInvites)
+	manage.POST("/api/v1/admin/invite/revoke", ac.revokeInvite)
+
+	manage.POST("/api/v1/admin/impersonation/logs", ac.impersonationLogs)
 }
 
-// Login user login
+// Login user login, the one-time password or recovery code is required if two-factor authentication is enabled
 func (ac *AdminController) Login(ctx *gin.Context) (uint32, error) {
 	var (
 		admin struct {
 			Name string `json:"name" binding:"required,alphanum,min=2,max=30"`
-			Pwd  string `json:"pwd" binding:"printascii,min=6,max=30"`
+			Pwd  string `json:"pwd" binding:"required,max=72"`
+			Code string `json:"code" binding:"omitempty,alphanum"`
 		}
 	)
 
@@ -102,7 +202,41 @@ func (ac *AdminController) Login(ctx *gin.Context) (uint32, error) {
 		return 0, err
 	}
 
+	ctx.Set(loginNameKey, admin.Name)
+	ip := ctx.ClientIP()
+
+	err = ac.checkLoginLock(admin.Name, ip)
+	if err != nil {
+		return 0, err
+	}
+
 	ID, err := mysql.Login(ac.db, admin.Name, admin.Pwd)
+	if err != nil {
+		if failErr := ac.loginFailed(admin.Name, ip); failErr != nil {
+			ctx.Error(failErr)
+		}
+
+		return 0, err
+	}
+
+	ctx.Set(loginAdminKey, ID)
+
+	// a missing code is asked for, only a wrong code counts as a failure
+	err = ac.secondFactor(ID, admin.Code)
+	if err == errTOTPRequired {
+		return 0, err
+	}
+
+	if err != nil {
+		if failErr := ac.loginFailed(admin.Name, ip); failErr != nil {
+			ctx.Error(failErr)
+		}
+
+		return 0, err
+	}
+
+	// the login fails closed, failures left behind would lock the admin out later
+	err = mysql.ResetLoginFailures(ac.db, mysql.LockKindName, admin.Name)
 	if err != nil {
 		return 0, err
 	}
@@ -165,9 +299,9 @@ func (ac *AdminController) modifyPwd(ctx *gin.Context) {
 	var (
 		admin struct {
 			ID      uint32 `json:"id"           binding:"required"`
-			Pwd     string `json:"pwd"          binding:"printascii,min=6,max=30"`
-			NewPwd  string `json:"newpwd"       binding:"printascii,min=6,max=30"`
-			Confirm string `json:"confirm"      binding:"printascii,min=6,max=30"`
+			Pwd     string `json:"pwd"          binding:"required,max=72"`
+			NewPwd  string `json:"newpwd"       binding:"required,max=72"`
+			Confirm string `json:"confirm"      binding:"required,max=72"`
 		}
 	)
 
@@ -190,7 +324,14 @@ func (ac *AdminController) modifyPwd(ctx *gin.Context) {
 		return
 	}
 
-	err = mysql.ModifyPwd(ac.db, admin.ID, admin.Pwd, admin.NewPwd)
+	err = ac.PwdPolicy.Validate(admin.NewPwd)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusNotAcceptable, gin.H{"status": http.StatusNotAcceptable})
+		return
+	}
+
+	err = mysql.ModifyPwd(ac.db, admin.ID, admin.Pwd, admin.NewPwd, ac.PwdHistory)
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
@@ -215,7 +356,7 @@ func (ac *AdminController) modifyActive(ctx *gin.Context) {
 		return
 	}
 
-	err = mysql.ModifyActive(ac.db, &admin.ID, admin.Active)
+	err = mysql.ModifyActive(ac.db, &admin.ID, admin.Active, audit.NewEntry(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
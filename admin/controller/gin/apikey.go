@@ -0,0 +1,195 @@
+package gin
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Mictrlan/Miuer/admin/model/mysql"
+	permissionCon "github.com/Mictrlan/Miuer/permission/controller/gin"
+	permission "github.com/Mictrlan/Miuer/permission/model/mysql"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// APIKeyHeader is the request header that carries an api key
+	APIKeyHeader = "X-API-Key"
+
+	apiKeyAdminKey = "apikey_admin"
+	apiKeyIDKey    = "apikey_id"
+)
+
+var (
+	errAPIKeyScope   = errors.New("api key scope must be roles of the admin")
+	errDelegated     = errors.New("credentials can't be managed with an api key or under impersonation")
+	errAPIKeyExpires = errors.New("api key must expire in the future")
+)
+
+// authenticateAPIKey resolve the api key of request to its owner and scope,
+// it returns false if the request doesn't carry an api key
+func (c *AdminController) authenticateAPIKey(ctx *gin.Context) bool {
+	key := ctx.GetHeader(APIKeyHeader)
+	if key == "" {
+		return false
+	}
+
+	apiKey, err := mysql.GetAPIKey(c.db, key)
+	if err != nil {
+		ctx.Error(err)
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": http.StatusUnauthorized})
+		return true
+	}
+
+	ctx.Set(apiKeyAdminKey, apiKey.AdminID)
+	ctx.Set(apiKeyIDKey, apiKey.ID)
+
+	if len(apiKey.Scopes) > 0 {
+		scope := make(map[uint32]bool)
+		for _, rid := range apiKey.Scopes {
+			scope[rid] = true
+		}
+
+		ctx.Set(permissionCon.ScopeKey, scope)
+	}
+
+	return true
+}
+
+// rejectDelegated abort the request authenticated by an api key or made under impersonation,
+// only the admin itself can manage its credentials
+func rejectDelegated(ctx *gin.Context) bool {
+	_, byAPIKey := ctx.Get(apiKeyIDKey)
+	_, impersonated := actorID(ctx)
+
+	if byAPIKey || impersonated {
+		ctx.Error(errDelegated)
+		ctx.JSON(http.StatusForbidden, gin.H{"status": http.StatusForbidden})
+		return true
+	}
+
+	return false
+}
+
+// createAPIKey mint an api key for current admin, the key is only returned once
+func (ac *AdminController) createAPIKey(ctx *gin.Context) {
+	var (
+		req struct {
+			Name      string     `json:"name"       binding:"required,min=2,max=128"`
+			Scopes    []uint32   `json:"scopes"`
+			ExpiresAt *time.Time `json:"expires_at"`
+		}
+	)
+
+	if rejectDelegated(ctx) {
+		return
+	}
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		ctx.Error(errAPIKeyExpires)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	aid, err := ac.getUID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if len(req.Scopes) > 0 {
+		roles, err := permission.AssociatedRoleMap(ac.db, aid)
+		if err != nil {
+			ctx.Error(err)
+			ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+			return
+		}
+
+		for _, rid := range req.Scopes {
+			if !roles[rid] {
+				ctx.Error(errAPIKeyScope)
+				ctx.JSON(http.StatusForbidden, gin.H{"status": http.StatusForbidden})
+				return
+			}
+		}
+	}
+
+	id, key, err := mysql.CreateAPIKey(ac.db, aid, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"status": http.StatusCreated,
+		"id":     id,
+		"key":    key,
+	})
+}
+
+// listAPIKeys list the api keys of current admin
+func (ac *AdminController) listAPIKeys(ctx *gin.Context) {
+	aid, err := ac.getUID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	keys, err := mysql.ListAPIKeys(ac.db, aid)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status": http.StatusOK,
+		"keys":   keys,
+	})
+}
+
+// revokeAPIKey revoke an api key of current admin
+func (ac *AdminController) revokeAPIKey(ctx *gin.Context) {
+	var (
+		req struct {
+			ID uint64 `json:"id" binding:"required"`
+		}
+	)
+
+	if rejectDelegated(ctx) {
+		return
+	}
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	aid, err := ac.getUID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = mysql.RevokeAPIKey(ac.db, req.ID, aid)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
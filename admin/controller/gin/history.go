@@ -0,0 +1,153 @@
+package gin
+
+import (
+	"net/http"
+
+	"github.com/Mictrlan/Miuer/admin/model/mysql"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	loginNameKey  = "login_name"
+	loginAdminKey = "login_admin"
+
+	maxUserAgent = 512
+	maxReason    = 256
+	maxPath      = 512
+)
+
+// recordLogin write a login attempt to history, it never fails the login
+func (ac *AdminController) recordLogin(ctx *gin.Context, loginErr error) {
+	h := &mysql.LoginHistory{
+		Name:      ctx.GetString(loginNameKey),
+		IP:        ctx.ClientIP(),
+		UserAgent: truncate(ctx.Request.UserAgent(), maxUserAgent),
+		Success:   loginErr == nil,
+	}
+
+	if v, exists := ctx.Get(loginAdminKey); exists {
+		h.AdminID, _ = v.(uint32)
+	}
+
+	// a failed login is recorded against the admin named by it, unknown names stay 0
+	if h.AdminID == 0 && h.Name != "" {
+		h.AdminID, _ = mysql.GetIDByName(ac.db, h.Name)
+	}
+
+	if loginErr != nil {
+		h.Reason = truncate(loginErr.Error(), maxReason)
+	}
+
+	if err := mysql.InsertLoginHistory(ac.db, h); err != nil {
+		ctx.Error(err)
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+
+	return s
+}
+
+// history list the recent logins of an admin
+func (ac *AdminController) history(ctx *gin.Context) {
+	var (
+		req struct {
+			AdminID uint32 `json:"admin_id" binding:"required"`
+			Page    uint32 `json:"page"`
+			Size    uint32 `json:"size"     binding:"max=100"`
+		}
+	)
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	ac.listHistory(ctx, req.AdminID, req.Page, req.Size)
+}
+
+// selfHistory list the recent logins of current admin
+func (ac *AdminController) selfHistory(ctx *gin.Context) {
+	var (
+		req struct {
+			Page uint32 `json:"page"`
+			Size uint32 `json:"size" binding:"max=100"`
+		}
+	)
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	id, err := ac.getUID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	ac.listHistory(ctx, id, req.Page, req.Size)
+}
+
+func (ac *AdminController) listHistory(ctx *gin.Context, aid, page, size uint32) {
+	page, size = pagination(page, size)
+
+	histories, total, err := mysql.ListLoginHistory(ac.db, aid, (page-1)*size, size)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":    http.StatusOK,
+		"histories": histories,
+		"total":     total,
+		"page":      page,
+		"size":      size,
+	})
+}
+
+// newIPLogins list the successful logins from an ip the admin never used, admin_id 0 means all admins
+func (ac *AdminController) newIPLogins(ctx *gin.Context) {
+	var (
+		req struct {
+			AdminID uint32 `json:"admin_id"`
+			Page    uint32 `json:"page"`
+			Size    uint32 `json:"size"     binding:"max=100"`
+		}
+	)
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	page, size := pagination(req.Page, req.Size)
+
+	histories, total, err := mysql.ListNewIPLogins(ac.db, req.AdminID, (page-1)*size, size)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":    http.StatusOK,
+		"histories": histories,
+		"total":     total,
+		"page":      page,
+		"size":      size,
+	})
+}
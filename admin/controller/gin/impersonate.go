@@ -0,0 +1,199 @@
+package gin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Mictrlan/Miuer/admin/model/mysql"
+	audit "github.com/Mictrlan/Miuer/audit/controller/gin"
+
+	ginjwt "github.com/appleboy/gin-jwt"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ImpersonatePermission is the named permission required to act as another admin
+	ImpersonatePermission = "admin:impersonate"
+
+	// ImpersonationHeader is set in every response to a request made under impersonation,
+	// its value is the id of the real admin
+	ImpersonationHeader = "X-Impersonated-By"
+)
+
+var (
+	errImpersonateSelf     = errors.New("can't impersonate yourself")
+	errImpersonateInactive = errors.New("can't impersonate an inactive admin")
+)
+
+// Impersonator return the real admin of an impersonated request for the audit log, ok is false
+// if the request is not impersonated
+func Impersonator(ctx *gin.Context) (uint32, bool) {
+	return actorID(ctx)
+}
+
+// actorID return the real admin of an impersonation token, ok is false if the request is not impersonated
+func actorID(ctx *gin.Context) (uint32, bool) {
+	actor, exists := ginjwt.ExtractClaims(ctx)["actor"]
+	if !exists {
+		return 0, false
+	}
+
+	actorNew, ok := actor.(float64)
+	if !ok {
+		return 0, false
+	}
+
+	return uint32(actorNew), true
+}
+
+// markImpersonation set the banner header when the request is impersonated
+func markImpersonation(ctx *gin.Context) {
+	if actor, ok := actorID(ctx); ok {
+		ctx.Header(ImpersonationHeader, strconv.FormatUint(uint64(actor), 10))
+	}
+}
+
+// auditImpersonation record the finished request with both identities when it is impersonated
+func (c *AdminController) auditImpersonation(ctx *gin.Context) {
+	actor, ok := actorID(ctx)
+	if !ok {
+		return
+	}
+
+	aid, _ := c.getUID(ctx)
+	sid, _ := sessionID(ctx)
+
+	l := &mysql.ImpersonationLog{
+		ActorID:   actor,
+		AdminID:   aid,
+		SessionID: sid,
+		Method:    ctx.Request.Method,
+		Path:      truncate(ctx.Request.URL.Path, maxPath),
+		Status:    ctx.Writer.Status(),
+		IP:        ctx.ClientIP(),
+	}
+
+	if err := mysql.InsertImpersonationLog(c.db, l); err != nil {
+		ctx.Error(err)
+	}
+}
+
+// impersonate issue an access token by which current admin acts as another admin,
+// the token is bound to the session of current admin and can't be refreshed
+func (ac *AdminController) impersonate(ctx *gin.Context) {
+	var (
+		req struct {
+			AdminID uint32 `json:"admin_id" binding:"required"`
+		}
+	)
+
+	if rejectDelegated(ctx) {
+		return
+	}
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	actor, err := ac.getUID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if actor == req.AdminID {
+		ctx.Error(errImpersonateSelf)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	sid, err := sessionID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	active, err := mysql.IsActive(ac.db, req.AdminID)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	if !active {
+		ctx.Error(errImpersonateInactive)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	err = ac.CanImpersonate(actor, req.AdminID)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusForbidden, gin.H{"status": http.StatusForbidden})
+		return
+	}
+
+	err = mysql.RecordImpersonation(ac.db, req.AdminID, sid, audit.NewEntry(ctx))
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError})
+		return
+	}
+
+	token, expire, err := ac.generateToken(&session{AdminID: req.AdminID, SessionID: sid, ActorID: actor})
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":          http.StatusOK,
+		"token":         token,
+		"expire":        expire.Format(time.RFC3339),
+		"impersonating": req.AdminID,
+	})
+}
+
+// impersonationLogs list the requests made under impersonation, 0 of actor_id or admin_id means any admin
+func (ac *AdminController) impersonationLogs(ctx *gin.Context) {
+	var (
+		req struct {
+			ActorID uint32 `json:"actor_id"`
+			AdminID uint32 `json:"admin_id"`
+			Page    uint32 `json:"page"`
+			Size    uint32 `json:"size"     binding:"max=100"`
+		}
+	)
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	page, size := pagination(req.Page, req.Size)
+
+	logs, total, err := mysql.ListImpersonationLogs(ac.db, req.ActorID, req.AdminID, (page-1)*size, size)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status": http.StatusOK,
+		"logs":   logs,
+		"total":  total,
+		"page":   page,
+		"size":   size,
+	})
+}
@@ -0,0 +1,202 @@
+package gin
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/Mictrlan/Miuer/admin/model/mysql"
+	permission "github.com/Mictrlan/Miuer/permission/model/mysql"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errInviteNoContact = errors.New("either email or mobile is required")
+	errInviteRole      = errors.New("only the active roles held by the inviter can be pre-assigned")
+)
+
+// RegisterInviteRouter register the public router to redeem invitations, it must be registered before the jwt middleware
+func (ac *AdminController) RegisterInviteRouter(r gin.IRouter) {
+	if r == nil {
+		log.Fatal(errServerNotExists)
+	}
+
+	err := mysql.CreateDataBase(ac.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = mysql.CreateInviteTable(ac.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r.POST("/api/v1/admin/invite/redeem", ac.redeemInvite)
+}
+
+// createInvite issue an invitation for an email or a mobile, the token is only returned once
+func (ac *AdminController) createInvite(ctx *gin.Context) {
+	var (
+		req struct {
+			Email  string   `json:"email"  binding:"omitempty,email"`
+			Mobile string   `json:"mobile" binding:"omitempty,numeric,len=11"`
+			Roles  []uint32 `json:"roles"`
+		}
+	)
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if req.Email == "" && req.Mobile == "" {
+		ctx.Error(errInviteNoContact)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	aid, err := ac.getUID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if len(req.Roles) > 0 {
+		roles, err := permission.AssociatedRoleMap(ac.db, aid)
+		if err != nil {
+			ctx.Error(err)
+			ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+			return
+		}
+
+		for _, rid := range req.Roles {
+			if !roles[rid] {
+				ctx.Error(errInviteRole)
+				ctx.JSON(http.StatusForbidden, gin.H{"status": http.StatusForbidden})
+				return
+			}
+		}
+	}
+
+	id, token, err := mysql.CreateInvite(ac.db, aid, req.Email, req.Mobile, req.Roles, ac.InviteTimeout)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"status": http.StatusCreated,
+		"id":     id,
+		"token":  token,
+	})
+}
+
+// listInvites list pending invitations
+func (ac *AdminController) listInvites(ctx *gin.Context) {
+	var (
+		req struct {
+			Page uint32 `json:"page"`
+			Size uint32 `json:"size" binding:"max=100"`
+		}
+	)
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	page, size := pagination(req.Page, req.Size)
+
+	invites, total, err := mysql.ListPendingInvites(ac.db, (page-1)*size, size)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"invites": invites,
+		"total":   total,
+		"page":    page,
+		"size":    size,
+	})
+}
+
+// revokeInvite revoke a pending invitation
+func (ac *AdminController) revokeInvite(ctx *gin.Context) {
+	var (
+		req struct {
+			ID uint64 `json:"id" binding:"required"`
+		}
+	)
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = mysql.RevokeInvite(ac.db, req.ID)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
+
+// redeemInvite create the invited admin with a password chosen by the invitee
+func (ac *AdminController) redeemInvite(ctx *gin.Context) {
+	var (
+		req struct {
+			Token   string `json:"token"    binding:"required,hexadecimal,len=64"`
+			Name    string `json:"name"     binding:"required,alphanum,min=2,max=30"`
+			Pwd     string `json:"pwd"      binding:"required,max=72"`
+			PwdConf string `json:"pwd_conf" binding:"required,max=72"`
+			Mobile  string `json:"mobile"   binding:"omitempty,numeric,len=11"`
+			Email   string `json:"email"    binding:"omitempty,email"`
+		}
+	)
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if req.Pwd != req.PwdConf {
+		ctx.Error(errPwdDisagree)
+		ctx.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict})
+		return
+	}
+
+	err = ac.PwdPolicy.Validate(req.Pwd)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusNotAcceptable, gin.H{"status": http.StatusNotAcceptable})
+		return
+	}
+
+	id, err := mysql.RedeemInvite(ac.db, req.Token, req.Name, req.Pwd, req.Email, req.Mobile)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusCreated, gin.H{
+		"status": http.StatusCreated,
+		"id":     id,
+	})
+}
@@ -0,0 +1,96 @@
+package gin
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Mictrlan/Miuer/admin/model/mysql"
+	audit "github.com/Mictrlan/Miuer/audit/controller/gin"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errLoginLocked  = errors.New("too many failed login attempts, try again later")
+	errLockKindFail = errors.New("lock kind must be name or ip")
+)
+
+// checkLoginLock reject the login when the account name or the client ip is locked
+func (ac *AdminController) checkLoginLock(name, ip string) error {
+	locked, err := mysql.IsLoginLocked(ac.db, mysql.LockKindName, name)
+	if err != nil {
+		return err
+	}
+
+	if locked {
+		return errLoginLocked
+	}
+
+	locked, err = mysql.IsLoginLocked(ac.db, mysql.LockKindIP, ip)
+	if err != nil {
+		return err
+	}
+
+	if locked {
+		return errLoginLocked
+	}
+
+	return nil
+}
+
+// loginFailed count a failed login against both the account name and the client ip, the ip is
+// counted even if the name can't be, the first error is returned
+func (ac *AdminController) loginFailed(name, ip string) error {
+	err := mysql.RecordLoginFailure(ac.db, mysql.LockKindName, name, &ac.LockoutPolicy)
+
+	if ipErr := mysql.RecordLoginFailure(ac.db, mysql.LockKindIP, ip, &ac.LockoutPolicy); err == nil {
+		err = ipErr
+	}
+
+	return err
+}
+
+func (ac *AdminController) listLoginLocks(ctx *gin.Context) {
+	locks, err := mysql.ListLoginLocks(ac.db)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status": http.StatusOK,
+		"locks":  locks,
+	})
+}
+
+func (ac *AdminController) clearLoginLock(ctx *gin.Context) {
+	var (
+		lock struct {
+			Kind    string `json:"kind"    binding:"required"`
+			Subject string `json:"subject" binding:"required,max=512"`
+		}
+	)
+
+	err := ctx.ShouldBind(&lock)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if lock.Kind != mysql.LockKindName && lock.Kind != mysql.LockKindIP {
+		ctx.Error(errLockKindFail)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = mysql.ClearLoginLock(ac.db, lock.Kind, lock.Subject, audit.NewEntry(ctx))
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
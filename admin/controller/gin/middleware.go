@@ -9,57 +9,179 @@ import (
 
 	ginjwt "github.com/appleboy/gin-jwt"
 	"github.com/gin-gonic/gin"
+	jwt "gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+const (
+	refreshTokenKey = "refresh_token"
 )
 
 var (
-	errUserIDNoExists = errors.New("user id no exists")
+	errUserIDNoExists    = errors.New("user id no exists")
+	errSessionNoExists   = errors.New("session no exists")
+	errInvalidTokenClaim = errors.New("invalid token claim")
 )
 
+// session is the data carried by an access token, ActorID is the real admin
+// when AdminID is impersonated
+type session struct {
+	AdminID   uint32
+	SessionID uint64
+	ActorID   uint32
+}
+
 // ExtendJWTMiddleWare improve the middleware and return a function that get uid after successful execution
 func (c *AdminController) ExtendJWTMiddleWare(authMW *ginjwt.GinJWTMiddleware) func(ctx *gin.Context) (uint32, error) {
+	c.authMW = authMW
+
+	if authMW.Timeout == 0 {
+		authMW.Timeout = time.Hour
+	}
+
 	authMW.Authenticator = func(ctx *gin.Context) (interface{}, error) {
-		return c.Login(ctx)
+		ID, err := c.Login(ctx)
+		if err != nil {
+			c.recordLogin(ctx, err)
+			return nil, err
+		}
+
+		sid, token, err := mysql.CreateSession(c.db, ID, c.RefreshTimeout)
+		if err != nil {
+			c.recordLogin(ctx, err)
+			return nil, err
+		}
+
+		ctx.Set(refreshTokenKey, token)
+		return &session{AdminID: ID, SessionID: sid}, nil
 	}
 
 	authMW.PayloadFunc = func(data interface{}) ginjwt.MapClaims {
-		if v, ok := data.(uint32); ok {
-			return ginjwt.MapClaims{
-				"identity": v,
+		if v, ok := data.(*session); ok {
+			claims := ginjwt.MapClaims{
+				"identity": v.AdminID,
+				"session":  v.SessionID,
+			}
+
+			if v.ActorID != 0 {
+				claims["actor"] = v.ActorID
 			}
+
+			c.extendClaims(claims, v.AdminID)
+
+			return claims
 		}
 
 		return ginjwt.MapClaims{}
 	}
 
-	/*
-		authMW.IdentityHandler = func(ctx *gin.Context) interface{} {
-			claims := ginjwt.ExtractClaims(ctx)
+	authMW.IdentityHandler = func(claims jwt.MapClaims) interface{} {
+		return claims["identity"]
+	}
+
+	// revoked sessions are rejected even if the access token has not expired
+	authMW.Authorizator = func(data interface{}, ctx *gin.Context) bool {
+		sid, err := sessionID(ctx)
+		if err != nil {
+			return false
+		}
+
+		valid, err := mysql.IsSessionValid(c.db, sid)
+		if err != nil {
+			ctx.Error(err)
+			return false
+		}
 
-			return claims["identity"]
+		if valid {
+			markImpersonation(ctx)
 		}
-	*/
-	authMW.IdentityHandler = func(ctx *gin.Context) interface{} {
-		claims := ginjwt.ExtractClaims(ctx)
-		return claims
+
+		return valid
 	}
 
-	authMW.LoginResponse = func(c *gin.Context, code int, token string, expire time.Time) {
-		c.JSON(http.StatusOK, gin.H{
-			"code":   http.StatusOK,
-			"token":  token,
-			"expire": expire.Format(time.RFC3339),
+	authMW.LoginResponse = func(ctx *gin.Context, code int, token string, expire time.Time) {
+		c.recordLogin(ctx, nil)
+
+		ctx.JSON(http.StatusOK, gin.H{
+			"code":          http.StatusOK,
+			"token":         token,
+			"expire":        expire.Format(time.RFC3339),
+			"refresh_token": ctx.GetString(refreshTokenKey),
 		})
 	}
 
-	return func(ctx *gin.Context) (uint32, error) {
-		ID, exists := ctx.Get("identity")
+	c.getUID = func(ctx *gin.Context) (uint32, error) {
+		if aid, exists := ctx.Get(apiKeyAdminKey); exists {
+			return aid.(uint32), nil
+		}
+
+		ID, exists := ginjwt.ExtractClaims(ctx)["identity"]
 		if !exists {
 			return 0, errUserIDNoExists
 		}
 
-		IDNew := ID.(float64)
+		IDNew, ok := ID.(float64)
+		if !ok {
+			return 0, errInvalidTokenClaim
+		}
+
 		return uint32(IDNew), nil
 	}
+
+	return c.getUID
+}
+
+// extendClaims add the claims of TokenClaims that are not set yet
+func (c *AdminController) extendClaims(claims ginjwt.MapClaims, aid uint32) {
+	if c.TokenClaims == nil {
+		return
+	}
+
+	extra, err := c.TokenClaims(aid)
+	if err != nil {
+		return
+	}
+
+	for key, value := range extra {
+		if _, exists := claims[key]; !exists {
+			claims[key] = value
+		}
+	}
+}
+
+// Authenticate return a middleware that accepts either an api key in APIKeyHeader or a jwt,
+// so that GetUID resolves both to an admin. The requests made under impersonation are audited.
+func (c *AdminController) Authenticate() func(ctx *gin.Context) {
+	return func(ctx *gin.Context) {
+		if c.authenticateAPIKey(ctx) {
+			return
+		}
+
+		if c.Keys != nil {
+			c.verifyToken(ctx)
+			if !ctx.IsAborted() {
+				ctx.Next()
+			}
+		} else {
+			c.authMW.MiddlewareFunc()(ctx)
+		}
+
+		c.auditImpersonation(ctx)
+	}
+}
+
+// sessionID return the session id carried by access token
+func sessionID(ctx *gin.Context) (uint64, error) {
+	sid, exists := ginjwt.ExtractClaims(ctx)["session"]
+	if !exists {
+		return 0, errSessionNoExists
+	}
+
+	sidNew, ok := sid.(float64)
+	if !ok {
+		return 0, errInvalidTokenClaim
+	}
+
+	return uint64(sidNew), nil
 }
 
 // CheckIsActive is a middlerware that check user active
@@ -0,0 +1,113 @@
+package gin
+
+import (
+	"net/http"
+
+	"github.com/Mictrlan/Miuer/admin/model/mysql"
+	permission "github.com/Mictrlan/Miuer/permission/model/mysql"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 20
+)
+
+// pagination fill the default page and size, page starts from 1
+func pagination(page, size uint32) (uint32, uint32) {
+	if page == 0 {
+		page = 1
+	}
+
+	if size == 0 {
+		size = defaultPageSize
+	}
+
+	return page, size
+}
+
+// list admins by page, filter by keyword of name, mobile or email and by active
+func (ac *AdminController) list(ctx *gin.Context) {
+	var (
+		admin struct {
+			Keyword string `json:"keyword" binding:"max=128"`
+			Active  *bool  `json:"active"`
+			Page    uint32 `json:"page"`
+			Size    uint32 `json:"size"    binding:"max=100"`
+		}
+
+		active int8 = -1
+	)
+
+	err := ctx.ShouldBind(&admin)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	admin.Page, admin.Size = pagination(admin.Page, admin.Size)
+
+	if admin.Active != nil {
+		active = 0
+		if *admin.Active {
+			active = 1
+		}
+	}
+
+	admins, total, err := mysql.ListAdmins(ac.db, admin.Keyword, active, (admin.Page-1)*admin.Size, admin.Size)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status": http.StatusOK,
+		"admins": admins,
+		"total":  total,
+		"page":   admin.Page,
+		"size":   admin.Size,
+	})
+}
+
+// info get an admin and its roles by id
+func (ac *AdminController) info(ctx *gin.Context) {
+	var (
+		admin struct {
+			ID uint32 `json:"id" binding:"required"`
+		}
+
+		roles = []*permission.RelationData{}
+	)
+
+	err := ctx.ShouldBind(&admin)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	result, err := mysql.GetAdminByID(ac.db, admin.ID)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	// roles of an inactive admin don't take effect
+	if result.Active {
+		roles, err = permission.AssociatedRoleList(ac.db, admin.ID)
+		if err != nil {
+			ctx.Error(err)
+			ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status": http.StatusOK,
+		"admin":  result,
+		"roles":  roles,
+	})
+}
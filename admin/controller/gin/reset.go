@@ -0,0 +1,292 @@
+package gin
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Mictrlan/Miuer/admin/model/mysql"
+	smsModel "github.com/Mictrlan/Miuer/smsservice/model/mysql"
+	services "github.com/Mictrlan/Miuer/smsservice/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errSMSNotExists     = errors.New("[RegisterResetRouter]: sms config is nil")
+	errResetCode        = errors.New("invalid password reset code")
+	errResetCodeExpired = errors.New("the password reset code has expired")
+)
+
+// RegisterResetRouter register password reset router, it must be registered before the jwt middleware
+func (ac *AdminController) RegisterResetRouter(r gin.IRouter) {
+	if r == nil {
+		log.Fatal(errServerNotExists)
+	}
+
+	if ac.SMSConf == nil {
+		log.Fatal(errSMSNotExists)
+	}
+
+	err := mysql.CreateDataBase(ac.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = mysql.CreateResetTable(ac.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r.POST("/api/v1/admin/reset/send", ac.sendResetCode)
+	r.POST("/api/v1/admin/reset/verify", ac.verifyResetCode)
+	r.POST("/api/v1/admin/reset/confirm", ac.resetPwd)
+}
+
+// resetSign is the sms sign of password reset for admin
+func resetSign(aid uint32) string {
+	return "reset" + strconv.FormatUint(uint64(aid), 10)
+}
+
+// sendResetCode send a verification code to the mobile of admin, the code sent before is replaced
+func (ac *AdminController) sendResetCode(ctx *gin.Context) {
+	var (
+		admin struct {
+			Name string `json:"name" binding:"required,alphanum,min=2,max=30"`
+		}
+	)
+
+	err := ctx.ShouldBind(&admin)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	aid, mobile, err := mysql.GetMobileByName(ac.db, admin.Name)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	// a mobile holds one message, the code sent before would refuse the new one until it is used up
+	err = smsModel.DeleteSmsMessageByMobile(ac.db, mobile)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	err = services.Send(ac.db, mobile, resetSign(aid), ac.SMSConf)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
+
+// verifyResetCode check the verification code and issue a single-use reset ticket. The code is refused
+// unless it was sent to the admin within ResetCodeTTL, and it is deleted after LockoutPolicy.MaxFailures
+// failures so that it can't be brute forced.
+func (ac *AdminController) verifyResetCode(ctx *gin.Context) {
+	var (
+		admin struct {
+			Name string `json:"name" binding:"required,alphanum,min=2,max=30"`
+			Code string `json:"code" binding:"required,numeric"`
+		}
+	)
+
+	err := ctx.ShouldBind(&admin)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	aid, mobile, err := mysql.GetMobileByName(ac.db, admin.Name)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	sign, ip := resetSign(aid), ctx.ClientIP()
+
+	err = ac.checkResetLock(admin.Name, ip, sign)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"status": http.StatusUnauthorized})
+		return
+	}
+
+	err = ac.verifyCode(sign, admin.Code)
+	if err != nil {
+		if ac.SMSConf.OnCheck != nil {
+			ac.SMSConf.OnCheck.OnVerifyFailed(sign, mobile)
+		}
+
+		if failErr := ac.resetFailed(admin.Name, ip, sign); failErr != nil {
+			ctx.Error(failErr)
+		}
+
+		ctx.Error(err)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"status": http.StatusUnauthorized})
+		return
+	}
+
+	if ac.SMSConf.OnCheck != nil {
+		ac.SMSConf.OnCheck.OnVerifySucceed(sign, mobile)
+	}
+
+	ticket, err := mysql.CreateResetTicket(ac.db, aid, ac.ResetTimeout)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status": http.StatusOK,
+		"ticket": ticket,
+	})
+}
+
+// checkResetLock reject the verification when the account name, the client ip or the reset code is locked
+func (ac *AdminController) checkResetLock(name, ip, sign string) error {
+	err := ac.checkLoginLock(name, ip)
+	if err != nil {
+		return err
+	}
+
+	locked, err := mysql.IsLoginLocked(ac.db, mysql.LockKindReset, sign)
+	if err != nil {
+		return err
+	}
+
+	if locked {
+		return errLoginLocked
+	}
+
+	return nil
+}
+
+// verifyCode check code against the reset code sent to sign, a code that is used up or expired is deleted
+func (ac *AdminController) verifyCode(sign, code string) error {
+	sent, err := smsModel.GetCodeBySign(ac.db, sign)
+	if err != nil {
+		return errResetCode
+	}
+
+	sentAt, err := smsModel.GetDateBySign(ac.db, sign)
+	if err != nil {
+		return errResetCode
+	}
+
+	err = checkResetCode(code, sent, time.Unix(sentAt, 0), time.Now(), ac.SMSConf.Digits, ac.ResetCodeTTL)
+	if err == errResetCodeExpired {
+		if delErr := smsModel.DeleteSmsMessage(ac.db, sign); delErr != nil {
+			return delErr
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = smsModel.DeleteSmsMessage(ac.db, sign)
+	if err != nil {
+		return err
+	}
+
+	return mysql.ResetLoginFailures(ac.db, mysql.LockKindReset, sign)
+}
+
+// resetFailed count a failed verification like a failed login, the reset code is deleted
+// once its failures reach LockoutPolicy.MaxFailures. The code is counted even if the name or ip
+// can't be, the first error is returned
+func (ac *AdminController) resetFailed(name, ip, sign string) error {
+	loginErr := ac.loginFailed(name, ip)
+
+	err := mysql.RecordLoginFailure(ac.db, mysql.LockKindReset, sign, &ac.LockoutPolicy)
+	if err != nil {
+		return err
+	}
+
+	failures, err := mysql.LoginFailures(ac.db, mysql.LockKindReset, sign)
+	if err != nil {
+		return err
+	}
+
+	if failures >= ac.LockoutPolicy.MaxFailures {
+		err = smsModel.DeleteSmsMessage(ac.db, sign)
+		if err != nil {
+			return err
+		}
+	}
+
+	return loginErr
+}
+
+// checkResetCode compare code with the code sent at sentAt, a code of the wrong length, an expired
+// code and a code never sent are refused
+func checkResetCode(code, sent string, sentAt, now time.Time, digits int, ttl time.Duration) error {
+	if len(code) != digits || len(sent) != digits {
+		return errResetCode
+	}
+
+	if !now.Before(sentAt.Add(ttl)) {
+		return errResetCodeExpired
+	}
+
+	if subtle.ConstantTimeCompare([]byte(code), []byte(sent)) != 1 {
+		return errResetCode
+	}
+
+	return nil
+}
+
+// resetPwd set a new password with the reset ticket
+func (ac *AdminController) resetPwd(ctx *gin.Context) {
+	var (
+		admin struct {
+			Ticket  string `json:"ticket"  binding:"required,hexadecimal,len=64"`
+			NewPwd  string `json:"newpwd"  binding:"required,max=72"`
+			Confirm string `json:"confirm" binding:"required,max=72"`
+		}
+	)
+
+	err := ctx.ShouldBind(&admin)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if admin.NewPwd != admin.Confirm {
+		ctx.Error(errPwdDisagree)
+		ctx.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict})
+		return
+	}
+
+	err = ac.PwdPolicy.Validate(admin.NewPwd)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusNotAcceptable, gin.H{"status": http.StatusNotAcceptable})
+		return
+	}
+
+	err = mysql.ResetPwd(ac.db, admin.Ticket, admin.NewPwd, ac.PwdHistory)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
@@ -0,0 +1,40 @@
+package gin
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckResetCode(t *testing.T) {
+	var (
+		ttl    = 10 * time.Minute
+		sentAt = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	)
+
+	tests := []struct {
+		name string
+		code string
+		sent string
+		now  time.Time
+		err  error
+	}{
+		{"match", "123456", "123456", sentAt.Add(time.Minute), nil},
+		{"match when sent", "123456", "123456", sentAt, nil},
+		{"mismatch", "123457", "123456", sentAt.Add(time.Minute), errResetCode},
+		{"expired", "123456", "123456", sentAt.Add(ttl), errResetCodeExpired},
+		{"long expired", "123456", "123456", sentAt.Add(time.Hour), errResetCodeExpired},
+		{"short code", "12345", "123456", sentAt.Add(time.Minute), errResetCode},
+		{"long code", "1234567", "123456", sentAt.Add(time.Minute), errResetCode},
+		{"empty code", "", "123456", sentAt.Add(time.Minute), errResetCode},
+		// GetCodeBySign used to return "0" for a missing code
+		{"missing code", "0", "0", sentAt.Add(time.Minute), errResetCode},
+		{"empty sent code", "", "", sentAt.Add(time.Minute), errResetCode},
+		{"short sent code", "12345", "12345", sentAt.Add(time.Minute), errResetCode},
+	}
+
+	for _, tt := range tests {
+		if err := checkResetCode(tt.code, tt.sent, sentAt, tt.now, 6, ttl); err != tt.err {
+			t.Errorf("%s: checkResetCode = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
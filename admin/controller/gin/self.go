@@ -0,0 +1,182 @@
+package gin
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/Mictrlan/Miuer/admin/model/mysql"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterSelfRouter register the routers by which an admin manages its own profile,
+// the admin id is taken from the access token instead of request.
+// It must be registered after the jwt middleware.
+func (ac *AdminController) RegisterSelfRouter(r gin.IRouter) {
+	if r == nil {
+		log.Fatal(errServerNotExists)
+	}
+
+	r.POST("/api/v1/admin/logout", ac.Logout)
+
+	r.POST("/api/v1/admin/self/info", ac.selfInfo)
+	r.POST("/api/v1/admin/self/modifyEmail", ac.selfModifyEmail)
+	r.POST("/api/v1/admin/self/modifyMobile", ac.selfModifyMobile)
+	r.POST("/api/v1/admin/self/modifyPwd", ac.selfModifyPwd)
+	r.POST("/api/v1/admin/self/history", ac.selfHistory)
+
+	r.POST("/api/v1/admin/totp/enroll", ac.enrollTOTP)
+	r.POST("/api/v1/admin/totp/confirm", ac.confirmTOTP)
+	r.POST("/api/v1/admin/totp/disable", ac.disableTOTP)
+
+	r.POST("/api/v1/admin/apikey/create", ac.createAPIKey)
+	r.POST("/api/v1/admin/apikey/list", ac.listAPIKeys)
+	r.POST("/api/v1/admin/apikey/revoke", ac.revokeAPIKey)
+}
+
+func (ac *AdminController) selfInfo(ctx *gin.Context) {
+	id, err := ac.getUID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	result, err := mysql.GetAdminByID(ac.db, id)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status": http.StatusOK,
+		"admin":  result,
+	})
+}
+
+func (ac *AdminController) selfModifyEmail(ctx *gin.Context) {
+	var (
+		admin struct {
+			Email string `json:"email"  binding:"required,email"`
+		}
+	)
+
+	if rejectDelegated(ctx) {
+		return
+	}
+
+	err := ctx.ShouldBind(&admin)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	id, err := ac.getUID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = mysql.ModifyEmail(ac.db, id, admin.Email)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
+
+func (ac *AdminController) selfModifyMobile(ctx *gin.Context) {
+	var (
+		admin struct {
+			Mobile string `json:"mobile"    binding:"required,numeric,len=11"`
+		}
+	)
+
+	if rejectDelegated(ctx) {
+		return
+	}
+
+	err := ctx.ShouldBind(&admin)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	id, err := ac.getUID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = mysql.ModifyMobile(ac.db, &id, &admin.Mobile)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
+
+func (ac *AdminController) selfModifyPwd(ctx *gin.Context) {
+	var (
+		admin struct {
+			Pwd     string `json:"pwd"          binding:"required,max=72"`
+			NewPwd  string `json:"newpwd"       binding:"required,max=72"`
+			Confirm string `json:"confirm"      binding:"required,max=72"`
+		}
+	)
+
+	if rejectDelegated(ctx) {
+		return
+	}
+
+	err := ctx.ShouldBind(&admin)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if admin.NewPwd == admin.Pwd {
+		ctx.Error(errPwdRepeat)
+		ctx.JSON(http.StatusExpectationFailed, gin.H{"status": http.StatusExpectationFailed})
+		return
+	}
+
+	if admin.NewPwd != admin.Confirm {
+		ctx.Error(errPwdDisagree)
+		ctx.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict})
+		return
+	}
+
+	err = ac.PwdPolicy.Validate(admin.NewPwd)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusNotAcceptable, gin.H{"status": http.StatusNotAcceptable})
+		return
+	}
+
+	id, err := ac.getUID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = mysql.ModifyPwd(ac.db, id, admin.Pwd, admin.NewPwd, ac.PwdHistory)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
@@ -0,0 +1,92 @@
+package gin
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Mictrlan/Miuer/admin/model/mysql"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errJWTNotExtended = errors.New("[Refresh]: ExtendJWTMiddleWare has not been called")
+	errAdminInactive  = errors.New("the admin is not activated")
+)
+
+// Refresh exchange a refresh token for a new access token and a new refresh token
+func (ac *AdminController) Refresh(ctx *gin.Context) {
+	var (
+		req struct {
+			RefreshToken string `json:"refresh_token" binding:"required,hexadecimal,len=64"`
+		}
+	)
+
+	if ac.authMW == nil {
+		ctx.Error(errJWTNotExtended)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError})
+		return
+	}
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	sid, aid, refreshToken, err := mysql.RotateSession(ac.db, req.RefreshToken, ac.RefreshTimeout)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"status": http.StatusUnauthorized})
+		return
+	}
+
+	active, err := mysql.IsActive(ac.db, aid)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"status": http.StatusUnauthorized})
+		return
+	}
+
+	if !active {
+		mysql.RevokeSession(ac.db, sid)
+		ctx.Error(errAdminInactive)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"status": http.StatusUnauthorized})
+		return
+	}
+
+	token, expire, err := ac.generateToken(&session{AdminID: aid, SessionID: sid})
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"code":          http.StatusOK,
+		"token":         token,
+		"expire":        expire.Format(time.RFC3339),
+		"refresh_token": refreshToken,
+	})
+}
+
+// Logout revoke the session of current access token
+func (ac *AdminController) Logout(ctx *gin.Context) {
+	sid, err := sessionID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = mysql.RevokeSession(ac.db, sid)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
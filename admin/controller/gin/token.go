@@ -0,0 +1,133 @@
+package gin
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	ginjwt "github.com/appleboy/gin-jwt"
+	"github.com/gin-gonic/gin"
+	jwt "gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+const (
+	jwtPayloadKey = "JWT_PAYLOAD"
+	jwtTokenKey   = "JWT_TOKEN"
+	jwtUserIDKey  = "userID"
+
+	authorizationHeader = "Authorization"
+	bearerHeadName      = "Bearer"
+)
+
+var (
+	errInvalidAuthHeader = errors.New("auth header is empty or invalid")
+	errNoKeySet          = errors.New("[JWKS]: key set is not configured")
+)
+
+// LoginHandler issue an access token, it signs with Keys when configured, otherwise it is the
+// LoginHandler of the extended jwt middleware
+func (c *AdminController) LoginHandler(ctx *gin.Context) {
+	if c.Keys == nil {
+		c.authMW.LoginHandler(ctx)
+		return
+	}
+
+	data, err := c.authMW.Authenticator(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"status": http.StatusUnauthorized})
+		return
+	}
+
+	sess, _ := data.(*session)
+
+	token, expire, err := c.generateToken(sess)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError})
+		return
+	}
+
+	c.authMW.LoginResponse(ctx, http.StatusOK, token, expire)
+}
+
+// generateToken sign an access token of session
+func (c *AdminController) generateToken(sess *session) (string, time.Time, error) {
+	uid := strconv.FormatUint(uint64(sess.AdminID), 10)
+
+	if c.Keys == nil {
+		return c.authMW.TokenGenerator(uid, sess)
+	}
+
+	now := c.now()
+	expire := now.UTC().Add(c.authMW.Timeout)
+
+	claims := jwt.MapClaims{
+		"id":       uid,
+		"exp":      expire.Unix(),
+		"orig_iat": now.Unix(),
+	}
+
+	for key, value := range c.authMW.PayloadFunc(sess) {
+		claims[key] = value
+	}
+
+	token, err := c.Keys.Sign(claims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return token, expire, nil
+}
+
+// verifyToken is the jwt middleware when Keys is configured, the claims are stored the same
+// way as the jwt middleware so that ginjwt.ExtractClaims keeps working
+func (c *AdminController) verifyToken(ctx *gin.Context) {
+	parts := strings.SplitN(ctx.GetHeader(authorizationHeader), " ", 2)
+	if len(parts) != 2 || parts[0] != bearerHeadName {
+		ctx.Error(errInvalidAuthHeader)
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": http.StatusUnauthorized})
+		return
+	}
+
+	token, err := jwt.Parse(parts[1], c.Keys.Keyfunc)
+	if err != nil {
+		ctx.Error(err)
+		ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"status": http.StatusUnauthorized})
+		return
+	}
+
+	claims := token.Claims.(jwt.MapClaims)
+	id := c.authMW.IdentityHandler(claims)
+
+	ctx.Set(jwtPayloadKey, claims)
+	ctx.Set(jwtTokenKey, parts[1])
+	ctx.Set(jwtUserIDKey, id)
+
+	if !c.authMW.Authorizator(id, ctx) {
+		ctx.Error(ginjwt.ErrForbidden)
+		ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"status": http.StatusForbidden})
+		return
+	}
+}
+
+func (c *AdminController) now() time.Time {
+	if c.authMW.TimeFunc != nil {
+		return c.authMW.TimeFunc()
+	}
+
+	return time.Now()
+}
+
+// JWKS publish the public keys that verify access tokens
+func (c *AdminController) JWKS(ctx *gin.Context) {
+	if c.Keys == nil {
+		ctx.Error(errNoKeySet)
+		ctx.JSON(http.StatusNotFound, gin.H{"status": http.StatusNotFound})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, c.Keys.JWKS())
+}
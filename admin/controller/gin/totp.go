@@ -0,0 +1,205 @@
+package gin
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Mictrlan/Miuer/admin/model/mysql"
+	"github.com/Mictrlan/Miuer/admin/utility"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	totpIssuer = "Miuer"
+)
+
+var (
+	errTOTPRequired    = errors.New("two-factor authentication code is required")
+	errInvalidTOTPCode = errors.New("invalid two-factor authentication code")
+	errTOTPNotEnrolled = errors.New("two-factor authentication has not been enrolled")
+)
+
+// secondFactor verify the one-time password or recovery code when admin has enabled two-factor authentication
+func (ac *AdminController) secondFactor(aid uint32, code string) error {
+	enabled, err := mysql.TOTPEnabled(ac.db, aid)
+	if err != nil {
+		return err
+	}
+
+	if !enabled {
+		return nil
+	}
+
+	if code == "" {
+		return errTOTPRequired
+	}
+
+	if len(code) != utility.TOTPDigits {
+		return mysql.UseRecoveryCode(ac.db, aid, code)
+	}
+
+	totp, err := mysql.GetTOTP(ac.db, aid)
+	if err != nil {
+		return err
+	}
+
+	step, ok := utility.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return errInvalidTOTPCode
+	}
+
+	return mysql.UseTOTPStep(ac.db, aid, step)
+}
+
+// enrollTOTP generate a new secret for current admin, it takes effect after confirmed
+func (ac *AdminController) enrollTOTP(ctx *gin.Context) {
+	if rejectDelegated(ctx) {
+		return
+	}
+
+	aid, err := ac.getUID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	name, err := mysql.GetName(ac.db, aid)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	secret, err := utility.GenerateSecret()
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError})
+		return
+	}
+
+	err = mysql.CreateTOTP(ac.db, aid, secret)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusConflict, gin.H{"status": http.StatusConflict})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status": http.StatusOK,
+		"secret": secret,
+		"uri":    utility.OTPAuthURI(totpIssuer, name, secret),
+	})
+}
+
+// confirmTOTP enable two-factor authentication with the first code and return recovery codes
+func (ac *AdminController) confirmTOTP(ctx *gin.Context) {
+	var (
+		req struct {
+			Code string `json:"code" binding:"required,numeric,len=6"`
+		}
+	)
+
+	if rejectDelegated(ctx) {
+		return
+	}
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	aid, err := ac.getUID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	totp, err := mysql.GetTOTP(ac.db, aid)
+	if err != nil {
+		ctx.Error(errTOTPNotEnrolled)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	step, ok := utility.ValidateTOTP(totp.Secret, req.Code, time.Now())
+	if !ok {
+		ctx.Error(errInvalidTOTPCode)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"status": http.StatusUnauthorized})
+		return
+	}
+
+	err = mysql.UseTOTPStep(ac.db, aid, step)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"status": http.StatusUnauthorized})
+		return
+	}
+
+	codes, err := utility.RecoveryCodes(utility.RecoveryCodeCount)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusInternalServerError, gin.H{"status": http.StatusInternalServerError})
+		return
+	}
+
+	err = mysql.EnableTOTP(ac.db, aid, codes)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":         http.StatusOK,
+		"recovery_codes": codes,
+	})
+}
+
+// disableTOTP turn off two-factor authentication of current admin, a valid code is required
+func (ac *AdminController) disableTOTP(ctx *gin.Context) {
+	var (
+		req struct {
+			Code string `json:"code" binding:"required,alphanum"`
+		}
+	)
+
+	if rejectDelegated(ctx) {
+		return
+	}
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	aid, err := ac.getUID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = ac.secondFactor(aid, req.Code)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusUnauthorized, gin.H{"status": http.StatusUnauthorized})
+		return
+	}
+
+	err = mysql.DisableTOTP(ac.db, aid)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
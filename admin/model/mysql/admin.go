@@ -3,7 +3,10 @@ package mysql
 import (
 	"database/sql"
 	"errors"
+	"log"
+	"strings"
 
+	audit "github.com/Mictrlan/Miuer/audit/model/mysql"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -18,11 +21,41 @@ const (
 	mysqlUserModifyPwd
 	mysqlUserModifyActive
 	mysqlUserGetIsActive
+	mysqlUserGetName
+	mysqlUserGetMobileByName
+	mysqlUserList
+	mysqlUserCount
+	mysqlUserGetByID
+	mysqlUserGetIDByName
 )
 
+const logFmtRehash = "[Login]: password of admin %d is not rehashed: %v"
+
+// Admin is the user information without password
+type Admin struct {
+	ID        uint32
+	Name      string
+	Mobile    string
+	Email     string
+	Active    bool
+	CreatedAt string
+}
+
+// actions and target types of the audit entries recorded by admin
+const (
+	auditAdminActive      = "admin.active"
+	auditAdminImpersonate = "admin.impersonate"
+
+	auditTargetAdmin = "admin"
+)
+
+// BcryptCost is the cost of new password hashes, hashes with a lower cost are upgraded on login
+var BcryptCost = 10
+
 var (
 	errInvalidMysql = errors.New("affected 0 rows")
 	errLoginFailed  = errors.New("invalid name or password")
+	errNoMobile     = errors.New("the user has no mobile")
 
 	adminSQLString = []string{
 		`CREATE DATABASE IF NOT EXISTS admin`,
@@ -44,6 +77,12 @@ var (
 		`UPDATE admin.user SET pwd = ? WHERE id = ? LIMIT 1 `,
 		`UPDATE admin.user SET active = ? WHERE id = ? LIMIT 1`,
 		`SELECT active FROM admin.user WHERE id = ? LOCK IN SHARE MODE`,
+		`SELECT name FROM admin.user WHERE id = ? LOCK IN SHARE MODE`,
+		`SELECT id,mobile FROM admin.user WHERE name = ? AND active = true LOCK IN SHARE MODE`,
+		`SELECT id,name,mobile,email,active,created_at FROM admin.user WHERE (? = '' OR name LIKE ? OR mobile LIKE ? OR email LIKE ?) AND (? < 0 OR active = ?) ORDER BY id LIMIT ?,? LOCK IN SHARE MODE`,
+		`SELECT COUNT(*) FROM admin.user WHERE (? = '' OR name LIKE ? OR mobile LIKE ? OR email LIKE ?) AND (? < 0 OR active = ?) LOCK IN SHARE MODE`,
+		`SELECT id,name,mobile,email,active,created_at FROM admin.user WHERE id = ? LOCK IN SHARE MODE`,
+		`SELECT id FROM admin.user WHERE name = ? LOCK IN SHARE MODE`,
 	}
 )
 
@@ -66,19 +105,44 @@ func Create(db *sql.DB, name, pwd, mobile, email string) error {
 		return err
 	}
 
-	result, err := db.Exec(adminSQLString[mysqlUserInsert], name, hash, mobile, email)
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	result, err := tx.Exec(adminSQLString[mysqlUserInsert], name, hash, mobile, email)
 	if err != nil {
 		return err
 	}
 
 	if rows, _ := result.RowsAffected(); rows == 0 {
-		return errInvalidMysql
+		err = errInvalidMysql
+		return err
 	}
 
-	return nil
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(pwdHistorySQLString[mysqlPwdHistoryInsert], id, hash)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	return err
 }
 
-// Login return userid after successful login
+// Login return userid after successful login, the password is rehashed
+// when it was hashed with a cost lower than BcryptCost. A failed rehash is logged
+// and doesn't fail the login, the next login tries again.
 func Login(db *sql.DB, name, pwd string) (uint32, error) {
 	var (
 		id       uint32
@@ -94,6 +158,17 @@ func Login(db *sql.DB, name, pwd string) (uint32, error) {
 		return 0, errLoginFailed
 	}
 
+	if cost, err := bcrypt.Cost([]byte(password)); err == nil && cost < BcryptCost {
+		hash, err := SaltHashGenerate(pwd)
+		if err == nil {
+			_, err = db.Exec(adminSQLString[mysqlUserModifyPwd], hash, id)
+		}
+
+		if err != nil {
+			log.Printf(logFmtRehash, id, err)
+		}
+	}
+
 	return id, nil
 }
 
@@ -125,42 +200,109 @@ func ModifyMobile(db *sql.DB, id *uint32, mobile *string) error {
 	return nil
 }
 
-// ModifyPwd modify user password by user id
-func ModifyPwd(db *sql.DB, id uint32, pwd, pwdNew string) error {
+// ModifyPwd modify user password by user id, the new password can't be
+// the same as the current one or the last history ones
+func ModifyPwd(db *sql.DB, id uint32, pwd, pwdNew string, history int) error {
 	var (
 		password string
 	)
 
-	err := db.QueryRow(adminSQLString[mysqlUserGetPwd], id).Scan(&password)
+	hash, err := SaltHashGenerate(pwdNew)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = tx.QueryRow(adminSQLString[mysqlUserGetPwd], id).Scan(&password)
 	if err != nil {
 		return err
 	}
 
 	if !SaltHashCompare([]byte(password), pwd) {
-		return errLoginFailed
+		err = errLoginFailed
+		return err
 	}
 
-	hash, err := SaltHashGenerate(pwdNew)
+	reused, err := pwdReused(tx, id, password, pwdNew, history)
+	if err != nil {
+		return err
+	}
+
+	if reused {
+		err = errPwdReused
+		return err
+	}
+
+	err = setPwd(tx, id, hash)
 	if err != nil {
 		return err
 	}
 
-	_, err = db.Exec(adminSQLString[mysqlUserModifyPwd], hash, id)
+	err = tx.Commit()
 	return err
 }
 
-// ModifyActive modify user active by id
-func ModifyActive(db *sql.DB, id *uint32, active bool) error {
-	result, err := db.Exec(adminSQLString[mysqlUserModifyActive], active, id)
+// ModifyActive modify user active by id, deactivating a user revokes all of its sessions.
+// entry is recorded in the same transaction.
+func ModifyActive(db *sql.DB, id *uint32, active bool, entry *audit.Entry) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	before, err := scanAdmin(tx.QueryRow(adminSQLString[mysqlUserGetByID], id))
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(adminSQLString[mysqlUserModifyActive], active, id)
 	if err != nil {
 		return err
 	}
 
 	if rows, _ := result.RowsAffected(); rows == 0 {
-		return errInvalidMysql
+		err = errInvalidMysql
+		return err
 	}
 
-	return nil
+	if !active {
+		_, err = tx.Exec(sessionSQLString[mysqlSessionRevokeByAdmin], id)
+		if err != nil {
+			return err
+		}
+	}
+
+	after := *before
+	after.Active = active
+
+	err = entry.Describe(auditAdminActive, auditTargetAdmin, *id).Change(before, &after)
+	if err != nil {
+		return err
+	}
+
+	err = audit.Record(tx, entry)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	return err
 }
 
 // IsActive query user active information
@@ -173,11 +315,113 @@ func IsActive(db *sql.DB, id uint32) (bool, error) {
 	return isActive, err
 }
 
+// GetName query user name by id
+func GetName(db *sql.DB, id uint32) (string, error) {
+	var (
+		name string
+	)
+
+	err := db.QueryRow(adminSQLString[mysqlUserGetName], id).Scan(&name)
+	return name, err
+}
+
+// GetIDByName query user id by name
+func GetIDByName(db *sql.DB, name string) (uint32, error) {
+	var (
+		id uint32
+	)
+
+	err := db.QueryRow(adminSQLString[mysqlUserGetIDByName], name).Scan(&id)
+	return id, err
+}
+
+// GetMobileByName query user id and mobile of an active user by name
+func GetMobileByName(db *sql.DB, name string) (uint32, string, error) {
+	var (
+		id     uint32
+		mobile sql.NullString
+	)
+
+	err := db.QueryRow(adminSQLString[mysqlUserGetMobileByName], name).Scan(&id, &mobile)
+	if err != nil {
+		return 0, "", err
+	}
+
+	if !mobile.Valid {
+		return 0, "", errNoMobile
+	}
+
+	return id, mobile.String, nil
+}
+
+// likeEscaper escape the LIKE wildcards and the escape character so that a keyword matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ListAdmins list users whose name, mobile or email contains keyword, active < 0 means any state.
+// It returns the users of the page and the total number of matched users.
+func ListAdmins(db *sql.DB, keyword string, active int8, offset, limit uint32) ([]*Admin, uint32, error) {
+	var (
+		total  uint32
+		admins []*Admin
+
+		like = "%" + likeEscaper.Replace(keyword) + "%"
+	)
+
+	err := db.QueryRow(adminSQLString[mysqlUserCount], keyword, like, like, like, active, active).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(adminSQLString[mysqlUserList], keyword, like, like, like, active, active, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		admin, err := scanAdmin(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		admins = append(admins, admin)
+	}
+
+	return admins, total, rows.Err()
+}
+
+// GetAdminByID query user information by id
+func GetAdminByID(db *sql.DB, id uint32) (*Admin, error) {
+	return scanAdmin(db.QueryRow(adminSQLString[mysqlUserGetByID], id))
+}
+
+// scanAdmin scan a user row into Admin, mobile and email may be null
+func scanAdmin(row interface {
+	Scan(dest ...interface{}) error
+}) (*Admin, error) {
+	var (
+		admin  Admin
+		mobile sql.NullString
+		email  sql.NullString
+	)
+
+	err := row.Scan(&admin.ID, &admin.Name, &mobile, &email, &admin.Active, &admin.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	admin.Mobile = mobile.String
+	admin.Email = email.String
+
+	return &admin, nil
+}
+
 // SaltHashGenerate encrypt user passwords
 func SaltHashGenerate(password string) (string, error) {
 	hex := []byte(password)
 
-	hashedPassword, err := bcrypt.GenerateFromPassword(hex, 10)
+	hashedPassword, err := bcrypt.GenerateFromPassword(hex, BcryptCost)
 	if err != nil {
 		return "", err
 	}
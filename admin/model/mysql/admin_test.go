@@ -0,0 +1,23 @@
+package mysql
+
+import "testing"
+
+func TestLikeEscaper(t *testing.T) {
+	tests := []struct {
+		keyword string
+		want    string
+	}{
+		{"", ""},
+		{"admin", "admin"},
+		{"100%", `100\%`},
+		{"first_name", `first\_name`},
+		{`a\b`, `a\\b`},
+		{`\%_`, `\\\%\_`},
+	}
+
+	for _, tt := range tests {
+		if got := likeEscaper.Replace(tt.keyword); got != tt.want {
+			t.Errorf("Replace(%q) = %q, want %q", tt.keyword, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	mysqlAPIKeyCreateTable = iota
+	mysqlAPIKeyInsert
+	mysqlAPIKeyGetByToken
+	mysqlAPIKeyListByAdmin
+	mysqlAPIKeyRevoke
+	mysqlAPIKeyTouch
+)
+
+// APIKey is a long-lived credential of admin for machine-to-machine access,
+// empty Scopes means all the roles of the admin
+type APIKey struct {
+	ID         uint64
+	AdminID    uint32
+	Name       string
+	Scopes     []uint32
+	ExpiresAt  string
+	Revoked    bool
+	LastUsedAt string
+	CreatedAt  string
+}
+
+var (
+	errInvalidAPIKey = errors.New("invalid, expired or revoked api key")
+
+	apiKeySQLString = []string{
+		`CREATE TABLE IF NOT EXISTS admin.api_key(
+			id            BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+			admin_id      BIGINT UNSIGNED NOT NULL,
+			name          VARCHAR(128) NOT NULL,
+			token         CHAR(64) UNIQUE NOT NULL,
+			scopes        VARCHAR(512) NOT NULL DEFAULT '',
+			expires_at    DATETIME DEFAULT NULL,
+			revoked       BOOLEAN DEFAULT FALSE,
+			last_used_at  DATETIME DEFAULT NULL,
+			created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(id),
+			UNIQUE KEY admin_name (admin_id,name)
+		) ENGINE=InnoDB AUTO_INCREMENT=1000 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;`,
+		`INSERT INTO admin.api_key(admin_id,name,token,scopes,expires_at)VALUES(?,?,?,?,?)`,
+		`SELECT api_key.id,api_key.admin_id,api_key.name,api_key.scopes FROM admin.api_key, admin.user WHERE api_key.token = ? AND api_key.revoked = false AND (api_key.expires_at IS NULL OR api_key.expires_at > ?) AND user.id = api_key.admin_id AND user.active = true LOCK IN SHARE MODE`,
+		`SELECT id,admin_id,name,scopes,expires_at,revoked,last_used_at,created_at FROM admin.api_key WHERE admin_id = ? ORDER BY id DESC LOCK IN SHARE MODE`,
+		`UPDATE admin.api_key SET revoked = true WHERE id = ? AND admin_id = ? LIMIT 1`,
+		`UPDATE admin.api_key SET last_used_at = ? WHERE id = ? LIMIT 1`,
+	}
+)
+
+// CreateAPIKeyTable create api key table
+func CreateAPIKeyTable(db *sql.DB) error {
+	_, err := db.Exec(apiKeySQLString[mysqlAPIKeyCreateTable])
+	return err
+}
+
+// CreateAPIKey mint a named api key for admin and return its id and the key,
+// only the digest of the key is stored, nil expiresAt means it never expires
+func CreateAPIKey(db *sql.DB, aid uint32, name string, scopes []uint32, expiresAt *time.Time) (uint64, string, error) {
+	key, err := randomToken()
+	if err != nil {
+		return 0, "", err
+	}
+
+	result, err := db.Exec(apiKeySQLString[mysqlAPIKeyInsert], aid, name, tokenDigest(key), joinScopes(scopes), expiresAt)
+	if err != nil {
+		return 0, "", err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return 0, "", errInvalidMysql
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, "", err
+	}
+
+	return uint64(id), key, nil
+}
+
+// GetAPIKey look up a valid api key whose owner is active, and record its usage
+func GetAPIKey(db *sql.DB, key string) (*APIKey, error) {
+	var (
+		apiKey APIKey
+		scopes string
+	)
+
+	err := db.QueryRow(apiKeySQLString[mysqlAPIKeyGetByToken], tokenDigest(key), time.Now()).Scan(&apiKey.ID, &apiKey.AdminID, &apiKey.Name, &scopes)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	apiKey.Scopes, err = splitScopes(scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	db.Exec(apiKeySQLString[mysqlAPIKeyTouch], time.Now(), apiKey.ID)
+
+	return &apiKey, nil
+}
+
+// ListAPIKeys list all the api keys of admin, the keys themselves are never returned
+func ListAPIKeys(db *sql.DB, aid uint32) ([]*APIKey, error) {
+	var (
+		keys []*APIKey
+	)
+
+	rows, err := db.Query(apiKeySQLString[mysqlAPIKeyListByAdmin], aid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			key        APIKey
+			scopes     string
+			expiresAt  sql.NullString
+			lastUsedAt sql.NullString
+		)
+
+		if err := rows.Scan(&key.ID, &key.AdminID, &key.Name, &scopes, &expiresAt, &key.Revoked, &lastUsedAt, &key.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		key.Scopes, err = splitScopes(scopes)
+		if err != nil {
+			return nil, err
+		}
+
+		key.ExpiresAt = expiresAt.String
+		key.LastUsedAt = lastUsedAt.String
+
+		keys = append(keys, &key)
+	}
+
+	return keys, rows.Err()
+}
+
+// RevokeAPIKey revoke an api key of admin
+func RevokeAPIKey(db *sql.DB, id uint64, aid uint32) error {
+	result, err := db.Exec(apiKeySQLString[mysqlAPIKeyRevoke], id, aid)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errInvalidMysql
+	}
+
+	return nil
+}
+
+func joinScopes(scopes []uint32) string {
+	s := make([]string, len(scopes))
+
+	for i, rid := range scopes {
+		s[i] = strconv.FormatUint(uint64(rid), 10)
+	}
+
+	return strings.Join(s, ",")
+}
+
+func splitScopes(s string) ([]uint32, error) {
+	var scopes []uint32
+
+	if s == "" {
+		return scopes, nil
+	}
+
+	for _, v := range strings.Split(s, ",") {
+		rid, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+
+		scopes = append(scopes, uint32(rid))
+	}
+
+	return scopes, nil
+}
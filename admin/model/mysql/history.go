@@ -0,0 +1,143 @@
+package mysql
+
+import (
+	"database/sql"
+)
+
+const (
+	mysqlHistoryCreateTable = iota
+	mysqlHistoryInsert
+	mysqlHistoryKnownIP
+	mysqlHistoryListByAdmin
+	mysqlHistoryCountByAdmin
+	mysqlHistoryListNewIP
+	mysqlHistoryCountNewIP
+)
+
+// LoginHistory is a record of login attempt
+type LoginHistory struct {
+	ID        uint64
+	AdminID   uint32
+	Name      string
+	IP        string
+	UserAgent string
+	Success   bool
+	Reason    string
+	NewIP     bool
+	CreatedAt string
+}
+
+var (
+	historySQLString = []string{
+		`CREATE TABLE IF NOT EXISTS admin.login_history(
+			id            BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+			admin_id      BIGINT UNSIGNED NOT NULL DEFAULT 0,
+			name          VARCHAR(512) NOT NULL DEFAULT ' ',
+			ip            VARCHAR(64) NOT NULL DEFAULT ' ',
+			user_agent    VARCHAR(512) NOT NULL DEFAULT ' ',
+			success       BOOLEAN DEFAULT FALSE,
+			reason        VARCHAR(256) NOT NULL DEFAULT ' ',
+			new_ip        BOOLEAN DEFAULT FALSE,
+			created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(id),
+			INDEX(admin_id,ip)
+		) ENGINE=InnoDB AUTO_INCREMENT=1000 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;`,
+		`INSERT INTO admin.login_history(admin_id,name,ip,user_agent,success,reason,new_ip)VALUES(?,?,?,?,?,?,?)`,
+		`SELECT COUNT(*) FROM admin.login_history WHERE admin_id = ? AND ip = ? AND success = true LOCK IN SHARE MODE`,
+		`SELECT id,admin_id,name,ip,user_agent,success,reason,new_ip,created_at FROM admin.login_history WHERE admin_id = ? ORDER BY id DESC LIMIT ?,? LOCK IN SHARE MODE`,
+		`SELECT COUNT(*) FROM admin.login_history WHERE admin_id = ? LOCK IN SHARE MODE`,
+		`SELECT id,admin_id,name,ip,user_agent,success,reason,new_ip,created_at FROM admin.login_history WHERE new_ip = true AND (? = 0 OR admin_id = ?) ORDER BY id DESC LIMIT ?,? LOCK IN SHARE MODE`,
+		`SELECT COUNT(*) FROM admin.login_history WHERE new_ip = true AND (? = 0 OR admin_id = ?) LOCK IN SHARE MODE`,
+	}
+)
+
+// CreateHistoryTable create login history table
+func CreateHistoryTable(db *sql.DB) error {
+	_, err := db.Exec(historySQLString[mysqlHistoryCreateTable])
+	return err
+}
+
+// InsertLoginHistory record a login attempt, a successful login is flagged
+// when the admin has never logged in successfully from the ip before
+func InsertLoginHistory(db *sql.DB, h *LoginHistory) error {
+	var known int
+
+	if h.Success {
+		err := db.QueryRow(historySQLString[mysqlHistoryKnownIP], h.AdminID, h.IP).Scan(&known)
+		if err != nil {
+			return err
+		}
+
+		h.NewIP = known == 0
+	}
+
+	result, err := db.Exec(historySQLString[mysqlHistoryInsert], h.AdminID, h.Name, h.IP, h.UserAgent, h.Success, h.Reason, h.NewIP)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errInvalidMysql
+	}
+
+	return nil
+}
+
+// ListLoginHistory list the recent login attempts of admin and the total number of them
+func ListLoginHistory(db *sql.DB, aid uint32, offset, limit uint32) ([]*LoginHistory, uint32, error) {
+	var total uint32
+
+	err := db.QueryRow(historySQLString[mysqlHistoryCountByAdmin], aid).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	histories, err := queryLoginHistory(db, historySQLString[mysqlHistoryListByAdmin], aid, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return histories, total, nil
+}
+
+// ListNewIPLogins list the successful logins from a new ip, aid 0 means all admins
+func ListNewIPLogins(db *sql.DB, aid uint32, offset, limit uint32) ([]*LoginHistory, uint32, error) {
+	var total uint32
+
+	err := db.QueryRow(historySQLString[mysqlHistoryCountNewIP], aid, aid).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	histories, err := queryLoginHistory(db, historySQLString[mysqlHistoryListNewIP], aid, aid, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return histories, total, nil
+}
+
+func queryLoginHistory(db *sql.DB, query string, args ...interface{}) ([]*LoginHistory, error) {
+	var (
+		histories []*LoginHistory
+	)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var h LoginHistory
+
+		if err := rows.Scan(&h.ID, &h.AdminID, &h.Name, &h.IP, &h.UserAgent, &h.Success, &h.Reason, &h.NewIP, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		histories = append(histories, &h)
+	}
+
+	return histories, rows.Err()
+}
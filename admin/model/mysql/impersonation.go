@@ -0,0 +1,119 @@
+package mysql
+
+import (
+	"database/sql"
+
+	audit "github.com/Mictrlan/Miuer/audit/model/mysql"
+)
+
+const (
+	mysqlImpersonationCreateTable = iota
+	mysqlImpersonationInsert
+	mysqlImpersonationList
+	mysqlImpersonationCount
+)
+
+// impersonationState is the audited state of an impersonation
+type impersonationState struct {
+	AdminID   uint32
+	SessionID uint64
+}
+
+// ImpersonationLog is a request made by ActorID while acting as AdminID, it is the access trail of
+// impersonation tokens. The start of impersonation and the changes made under it are in the audit log.
+type ImpersonationLog struct {
+	ID        uint64
+	ActorID   uint32
+	AdminID   uint32
+	SessionID uint64
+	Method    string
+	Path      string
+	Status    int
+	IP        string
+	CreatedAt string
+}
+
+var (
+	impersonationSQLString = []string{
+		`CREATE TABLE IF NOT EXISTS admin.impersonation_log(
+			id            BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+			actor_id      BIGINT UNSIGNED NOT NULL,
+			admin_id      BIGINT UNSIGNED NOT NULL,
+			session_id    BIGINT UNSIGNED NOT NULL,
+			method        VARCHAR(16) NOT NULL,
+			path          VARCHAR(512) NOT NULL,
+			status        INT NOT NULL,
+			ip            VARCHAR(64) NOT NULL DEFAULT ' ',
+			created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(id),
+			INDEX(actor_id),
+			INDEX(admin_id)
+		) ENGINE=InnoDB AUTO_INCREMENT=1000 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;`,
+		`INSERT INTO admin.impersonation_log(actor_id,admin_id,session_id,method,path,status,ip)VALUES(?,?,?,?,?,?,?)`,
+		`SELECT id,actor_id,admin_id,session_id,method,path,status,ip,created_at FROM admin.impersonation_log WHERE (? = 0 OR actor_id = ?) AND (? = 0 OR admin_id = ?) ORDER BY id DESC LIMIT ?,? LOCK IN SHARE MODE`,
+		`SELECT COUNT(*) FROM admin.impersonation_log WHERE (? = 0 OR actor_id = ?) AND (? = 0 OR admin_id = ?) LOCK IN SHARE MODE`,
+	}
+)
+
+// CreateImpersonationTable create impersonation log table
+func CreateImpersonationTable(db *sql.DB) error {
+	_, err := db.Exec(impersonationSQLString[mysqlImpersonationCreateTable])
+	return err
+}
+
+// RecordImpersonation record in the audit log that the actor of entry starts to act as aid in session sid
+func RecordImpersonation(db *sql.DB, aid uint32, sid uint64, entry *audit.Entry) error {
+	err := entry.Describe(auditAdminImpersonate, auditTargetAdmin, aid).Change(nil, &impersonationState{AdminID: aid, SessionID: sid})
+	if err != nil {
+		return err
+	}
+
+	return audit.Record(db, entry)
+}
+
+// InsertImpersonationLog record a request made under impersonation
+func InsertImpersonationLog(db *sql.DB, l *ImpersonationLog) error {
+	result, err := db.Exec(impersonationSQLString[mysqlImpersonationInsert], l.ActorID, l.AdminID, l.SessionID, l.Method, l.Path, l.Status, l.IP)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errInvalidMysql
+	}
+
+	return nil
+}
+
+// ListImpersonationLogs list the requests made under impersonation and the total count,
+// 0 of actor or aid means any admin
+func ListImpersonationLogs(db *sql.DB, actor, aid, offset, limit uint32) ([]*ImpersonationLog, uint32, error) {
+	var (
+		total uint32
+		logs  []*ImpersonationLog
+	)
+
+	err := db.QueryRow(impersonationSQLString[mysqlImpersonationCount], actor, actor, aid, aid).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(impersonationSQLString[mysqlImpersonationList], actor, actor, aid, aid, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var l ImpersonationLog
+
+		if err := rows.Scan(&l.ID, &l.ActorID, &l.AdminID, &l.SessionID, &l.Method, &l.Path, &l.Status, &l.IP, &l.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+
+		logs = append(logs, &l)
+	}
+
+	return logs, total, rows.Err()
+}
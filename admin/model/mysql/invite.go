@@ -0,0 +1,229 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	mysqlInviteCreateTable = iota
+	mysqlInviteInsert
+	mysqlInviteGetByToken
+	mysqlInviteRedeem
+	mysqlInviteRevoke
+	mysqlInviteListPending
+	mysqlInviteCountPending
+	mysqlInviteAddRelation
+)
+
+// Invite is a pending invitation, the token itself is never returned
+type Invite struct {
+	ID        uint64
+	Email     string
+	Mobile    string
+	Roles     []uint32
+	InviterID uint32
+	ExpiresAt string
+	CreatedAt string
+}
+
+var (
+	errInvalidInvite = errors.New("invalid, expired, used or revoked invitation")
+
+	inviteSQLString = []string{
+		`CREATE TABLE IF NOT EXISTS admin.invite(
+			id            BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+			token         CHAR(64) UNIQUE NOT NULL,
+			email         VARCHAR(128) DEFAULT NULL,
+			mobile        VARCHAR(32) DEFAULT NULL,
+			roles         VARCHAR(512) NOT NULL DEFAULT '',
+			inviter_id    BIGINT UNSIGNED NOT NULL,
+			admin_id      BIGINT UNSIGNED DEFAULT NULL,
+			revoked       BOOLEAN DEFAULT FALSE,
+			expires_at    DATETIME NOT NULL,
+			created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(id)
+		) ENGINE=InnoDB AUTO_INCREMENT=1000 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;`,
+		`INSERT INTO admin.invite(token,email,mobile,roles,inviter_id,expires_at)VALUES(?,?,?,?,?,?)`,
+		`SELECT id,email,mobile,roles FROM admin.invite WHERE token = ? AND admin_id IS NULL AND revoked = false AND expires_at > ? FOR UPDATE`,
+		`UPDATE admin.invite SET admin_id = ? WHERE id = ? LIMIT 1`,
+		`UPDATE admin.invite SET revoked = true WHERE id = ? AND admin_id IS NULL AND revoked = false LIMIT 1`,
+		`SELECT id,email,mobile,roles,inviter_id,expires_at,created_at FROM admin.invite WHERE admin_id IS NULL AND revoked = false AND expires_at > ? ORDER BY id DESC LIMIT ?,? LOCK IN SHARE MODE`,
+		`SELECT COUNT(*) FROM admin.invite WHERE admin_id IS NULL AND revoked = false AND expires_at > ? LOCK IN SHARE MODE`,
+		`INSERT INTO admin.relation(admin_id,role_id,created_at) SELECT ?,id,? FROM admin.role WHERE id = ? AND active = true`,
+	}
+)
+
+// CreateInviteTable create invitation table
+func CreateInviteTable(db *sql.DB) error {
+	_, err := db.Exec(inviteSQLString[mysqlInviteCreateTable])
+	return err
+}
+
+// CreateInvite issue an invitation for an email or a mobile with pre-assigned roles,
+// and return its id and token, only the digest of the token is stored
+func CreateInvite(db *sql.DB, inviter uint32, email, mobile string, roles []uint32, ttl time.Duration) (uint64, string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return 0, "", err
+	}
+
+	result, err := db.Exec(inviteSQLString[mysqlInviteInsert], tokenDigest(token), nullString(email), nullString(mobile), joinScopes(roles), inviter, time.Now().Add(ttl))
+	if err != nil {
+		return 0, "", err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return 0, "", errInvalidMysql
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, "", err
+	}
+
+	return uint64(id), token, nil
+}
+
+// RedeemInvite consume the invitation and create the admin with the roles of invitation,
+// the email and mobile of invitation take precedence over the ones given by invitee,
+// roles that are no longer active are skipped
+func RedeemInvite(db *sql.DB, token, name, pwd, email, mobile string) (uint32, error) {
+	var (
+		id                        uint64
+		inviteEmail, inviteMobile sql.NullString
+		roles                     string
+	)
+
+	hash, err := SaltHashGenerate(pwd)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = tx.QueryRow(inviteSQLString[mysqlInviteGetByToken], tokenDigest(token), time.Now()).Scan(&id, &inviteEmail, &inviteMobile, &roles)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = errInvalidInvite
+		}
+		return 0, err
+	}
+
+	if inviteEmail.Valid {
+		email = inviteEmail.String
+	}
+
+	if inviteMobile.Valid {
+		mobile = inviteMobile.String
+	}
+
+	roleIDs, err := splitScopes(roles)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(adminSQLString[mysqlUserInsert], name, hash, nullString(mobile), nullString(email))
+	if err != nil {
+		return 0, err
+	}
+
+	aid, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(pwdHistorySQLString[mysqlPwdHistoryInsert], aid, hash)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, rid := range roleIDs {
+		_, err = tx.Exec(inviteSQLString[mysqlInviteAddRelation], aid, time.Now(), rid)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.Exec(inviteSQLString[mysqlInviteRedeem], aid, id)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	return uint32(aid), err
+}
+
+// RevokeInvite revoke a pending invitation
+func RevokeInvite(db *sql.DB, id uint64) error {
+	result, err := db.Exec(inviteSQLString[mysqlInviteRevoke], id)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errInvalidInvite
+	}
+
+	return nil
+}
+
+// ListPendingInvites list the invitations that are neither used, revoked nor expired and the total count
+func ListPendingInvites(db *sql.DB, offset, limit uint32) ([]*Invite, uint32, error) {
+	var (
+		total   uint32
+		invites []*Invite
+		now     = time.Now()
+	)
+
+	err := db.QueryRow(inviteSQLString[mysqlInviteCountPending], now).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(inviteSQLString[mysqlInviteListPending], now, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			invite        Invite
+			email, mobile sql.NullString
+			roles         string
+		)
+
+		if err := rows.Scan(&invite.ID, &email, &mobile, &roles, &invite.InviterID, &invite.ExpiresAt, &invite.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+
+		invite.Roles, err = splitScopes(roles)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		invite.Email = email.String
+		invite.Mobile = mobile.String
+
+		invites = append(invites, &invite)
+	}
+
+	return invites, total, rows.Err()
+}
+
+// nullString store empty string as NULL, so that unique columns allow several empty values
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
@@ -0,0 +1,266 @@
+package mysql
+
+import (
+	"database/sql"
+	"time"
+
+	audit "github.com/Mictrlan/Miuer/audit/model/mysql"
+)
+
+const (
+	// LockKindName - failed logins counted by account name
+	LockKindName = "name"
+
+	// LockKindIP - failed logins counted by client ip
+	LockKindIP = "ip"
+
+	// LockKindReset - failed password reset codes counted by sms sign
+	LockKindReset = "reset"
+
+	auditLoginLock   = "login_lock.lock"
+	auditLoginUnlock = "login_lock.unlock"
+
+	// auditTargetLoginLock is followed by the kind of lock, e.g. login_lock.ip
+	auditTargetLoginLock = "login_lock."
+
+	// maxTargetID is the length of target id in the audit log, the full subject is in the state
+	maxTargetID = 128
+)
+
+const (
+	mysqlLockCreateTable = iota
+	mysqlLockRecordFailure
+	mysqlLockGetFailures
+	mysqlLockSetLockedUntil
+	mysqlLockIsLocked
+	mysqlLockDelete
+	mysqlLockList
+	mysqlLockFailures
+)
+
+type (
+	// LockoutPolicy controls backoff and lockout of failed logins
+	LockoutPolicy struct {
+		// MaxFailures is the number of failures that lock the subject out
+		MaxFailures int
+		// Backoff is the delay after the first failure, it doubles after each failure
+		Backoff time.Duration
+		// Lockout is how long the subject is locked after MaxFailures
+		Lockout time.Duration
+		// Window forgets failures older than it
+		Window time.Duration
+	}
+
+	// LoginLock -
+	LoginLock struct {
+		Kind         string
+		Subject      string
+		Failures     int
+		LockedUntil  string
+		LastFailedAt string
+	}
+
+	// lockState is the audited state of a lock
+	lockState struct {
+		Kind     string
+		Subject  string
+		Failures int
+	}
+)
+
+var (
+	lockSQLString = []string{
+		`CREATE TABLE IF NOT EXISTS admin.login_lock(
+			kind            VARCHAR(16) NOT NULL,
+			subject         VARCHAR(512) NOT NULL,
+			failures        INT UNSIGNED NOT NULL DEFAULT 0,
+			locked_until    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			last_failed_at  DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(kind,subject)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;`,
+		`INSERT INTO admin.login_lock(kind,subject,failures,last_failed_at)VALUES(?,?,1,?) ON DUPLICATE KEY UPDATE failures = IF(last_failed_at < ?, 1, failures + 1), last_failed_at = VALUES(last_failed_at)`,
+		`SELECT failures FROM admin.login_lock WHERE kind = ? AND subject = ? FOR UPDATE`,
+		`UPDATE admin.login_lock SET locked_until = ? WHERE kind = ? AND subject = ? LIMIT 1`,
+		`SELECT COUNT(*) FROM admin.login_lock WHERE kind = ? AND subject = ? AND locked_until > ? LOCK IN SHARE MODE`,
+		`DELETE FROM admin.login_lock WHERE kind = ? AND subject = ? LIMIT 1`,
+		`SELECT kind,subject,failures,locked_until,last_failed_at FROM admin.login_lock WHERE locked_until > ? LOCK IN SHARE MODE`,
+		`SELECT failures FROM admin.login_lock WHERE kind = ? AND subject = ? LOCK IN SHARE MODE`,
+	}
+)
+
+// CreateLockoutTable create login lock table. The locks and unlocks are in the audit log.
+func CreateLockoutTable(db *sql.DB) error {
+	_, err := db.Exec(lockSQLString[mysqlLockCreateTable])
+	return err
+}
+
+// describeLock describe entry as action on the lock of subject with failures before the change
+func describeLock(entry *audit.Entry, action, kind, subject string, failures int) error {
+	target := subject
+	if len(target) > maxTargetID {
+		target = target[:maxTargetID]
+	}
+
+	state := &lockState{Kind: kind, Subject: subject, Failures: failures}
+
+	if action == auditLoginLock {
+		return entry.Describe(action, auditTargetLoginLock+kind, target).Change(nil, state)
+	}
+
+	return entry.Describe(action, auditTargetLoginLock+kind, target).Change(state, nil)
+}
+
+// IsLoginLocked report whether the subject has to wait before next login
+func IsLoginLocked(db *sql.DB, kind, subject string) (bool, error) {
+	var count int
+
+	err := db.QueryRow(lockSQLString[mysqlLockIsLocked], kind, subject, time.Now()).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// RecordLoginFailure count a failed login of subject, the subject backs off exponentially
+// and is locked out when failures reach policy.MaxFailures, each lockout is audited as made by the system
+func RecordLoginFailure(db *sql.DB, kind, subject string, policy *LockoutPolicy) error {
+	var (
+		failures int
+		now      = time.Now()
+	)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec(lockSQLString[mysqlLockRecordFailure], kind, subject, now, now.Add(-policy.Window))
+	if err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(lockSQLString[mysqlLockGetFailures], kind, subject).Scan(&failures)
+	if err != nil {
+		return err
+	}
+
+	delay := policy.Lockout
+	if failures < policy.MaxFailures {
+		delay = policy.Backoff << uint(failures-1)
+		if delay > policy.Lockout || delay <= 0 {
+			delay = policy.Lockout
+		}
+	}
+
+	_, err = tx.Exec(lockSQLString[mysqlLockSetLockedUntil], now.Add(delay), kind, subject)
+	if err != nil {
+		return err
+	}
+
+	if failures >= policy.MaxFailures {
+		entry := &audit.Entry{}
+
+		err = describeLock(entry, auditLoginLock, kind, subject, failures)
+		if err != nil {
+			return err
+		}
+
+		err = audit.Record(tx, entry)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+// LoginFailures return the failures of subject counted in the window, 0 if there is none
+func LoginFailures(db *sql.DB, kind, subject string) (int, error) {
+	var failures int
+
+	err := db.QueryRow(lockSQLString[mysqlLockFailures], kind, subject).Scan(&failures)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return failures, err
+}
+
+// ResetLoginFailures forget failed logins of subject after a successful login
+func ResetLoginFailures(db *sql.DB, kind, subject string) error {
+	_, err := db.Exec(lockSQLString[mysqlLockDelete], kind, subject)
+	return err
+}
+
+// ClearLoginLock remove the lock of subject, entry is recorded in the same transaction
+func ClearLoginLock(db *sql.DB, kind, subject string, entry *audit.Entry) error {
+	var failures int
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = tx.QueryRow(lockSQLString[mysqlLockGetFailures], kind, subject).Scan(&failures)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(lockSQLString[mysqlLockDelete], kind, subject)
+	if err != nil {
+		return err
+	}
+
+	err = describeLock(entry, auditLoginUnlock, kind, subject, failures)
+	if err != nil {
+		return err
+	}
+
+	err = audit.Record(tx, entry)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+// ListLoginLocks list all the subjects that are locked now
+func ListLoginLocks(db *sql.DB) ([]*LoginLock, error) {
+	var (
+		locks []*LoginLock
+	)
+
+	rows, err := db.Query(lockSQLString[mysqlLockList], time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var lock LoginLock
+
+		if err := rows.Scan(&lock.Kind, &lock.Subject, &lock.Failures, &lock.LockedUntil, &lock.LastFailedAt); err != nil {
+			return nil, err
+		}
+
+		locks = append(locks, &lock)
+	}
+
+	return locks, rows.Err()
+}
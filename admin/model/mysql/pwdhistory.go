@@ -0,0 +1,78 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+)
+
+const (
+	mysqlPwdHistoryCreateTable = iota
+	mysqlPwdHistoryInsert
+	mysqlPwdHistoryRecent
+)
+
+var (
+	errPwdReused = errors.New("the new password has been used recently")
+
+	pwdHistorySQLString = []string{
+		`CREATE TABLE IF NOT EXISTS admin.pwd_history(
+			id            BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+			admin_id      BIGINT UNSIGNED NOT NULL,
+			pwd           VARCHAR(512) NOT NULL,
+			created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(id),
+			INDEX(admin_id)
+		) ENGINE=InnoDB AUTO_INCREMENT=1000 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;`,
+		`INSERT INTO admin.pwd_history(admin_id,pwd)VALUES(?,?)`,
+		`SELECT pwd FROM admin.pwd_history WHERE admin_id = ? ORDER BY id DESC LIMIT ?`,
+	}
+)
+
+// CreatePwdHistoryTable create password history table
+func CreatePwdHistoryTable(db *sql.DB) error {
+	_, err := db.Exec(pwdHistorySQLString[mysqlPwdHistoryCreateTable])
+	return err
+}
+
+// pwdReused report whether pwd matches the current hash or one of the last n hashes of admin
+func pwdReused(tx *sql.Tx, aid uint32, current, pwd string, n int) (bool, error) {
+	if SaltHashCompare([]byte(current), pwd) {
+		return true, nil
+	}
+
+	if n <= 0 {
+		return false, nil
+	}
+
+	rows, err := tx.Query(pwdHistorySQLString[mysqlPwdHistoryRecent], aid, n)
+	if err != nil {
+		return false, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var hash string
+
+		if err := rows.Scan(&hash); err != nil {
+			return false, err
+		}
+
+		if SaltHashCompare([]byte(hash), pwd) {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+// setPwd replace the password hash of admin and remember it in history
+func setPwd(tx *sql.Tx, aid uint32, hash string) error {
+	_, err := tx.Exec(adminSQLString[mysqlUserModifyPwd], hash, aid)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(pwdHistorySQLString[mysqlPwdHistoryInsert], aid, hash)
+	return err
+}
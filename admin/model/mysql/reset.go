@@ -0,0 +1,124 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	mysqlResetCreateTable = iota
+	mysqlResetInsert
+	mysqlResetGetByToken
+	mysqlResetUse
+)
+
+var (
+	errInvalidResetTicket = errors.New("invalid or expired reset ticket")
+
+	resetSQLString = []string{
+		`CREATE TABLE IF NOT EXISTS admin.reset_ticket(
+			token         CHAR(64) NOT NULL,
+			admin_id      BIGINT UNSIGNED NOT NULL,
+			used          BOOLEAN DEFAULT FALSE,
+			expires_at    DATETIME NOT NULL,
+			created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(token),
+			INDEX(admin_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;`,
+		`INSERT INTO admin.reset_ticket(token,admin_id,expires_at)VALUES(?,?,?)`,
+		`SELECT admin_id FROM admin.reset_ticket WHERE token = ? AND used = false AND expires_at > ? FOR UPDATE`,
+		`UPDATE admin.reset_ticket SET used = true WHERE token = ? LIMIT 1`,
+	}
+)
+
+// CreateResetTable create password reset ticket table
+func CreateResetTable(db *sql.DB) error {
+	_, err := db.Exec(resetSQLString[mysqlResetCreateTable])
+	return err
+}
+
+// CreateResetTicket issue a single-use password reset ticket for admin
+func CreateResetTicket(db *sql.DB, aid uint32, ttl time.Duration) (string, error) {
+	ticket, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	result, err := db.Exec(resetSQLString[mysqlResetInsert], tokenDigest(ticket), aid, time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return "", errInvalidMysql
+	}
+
+	return ticket, nil
+}
+
+// ResetPwd consume the reset ticket and set a new password without the old one,
+// the new password can't be one of the last history ones, all the sessions of the admin are revoked
+func ResetPwd(db *sql.DB, ticket, pwdNew string, history int) error {
+	var (
+		aid      uint32
+		password string
+	)
+
+	hash, err := SaltHashGenerate(pwdNew)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = tx.QueryRow(resetSQLString[mysqlResetGetByToken], tokenDigest(ticket), time.Now()).Scan(&aid)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = errInvalidResetTicket
+		}
+		return err
+	}
+
+	err = tx.QueryRow(adminSQLString[mysqlUserGetPwd], aid).Scan(&password)
+	if err != nil {
+		return err
+	}
+
+	reused, err := pwdReused(tx, aid, password, pwdNew, history)
+	if err != nil {
+		return err
+	}
+
+	if reused {
+		err = errPwdReused
+		return err
+	}
+
+	_, err = tx.Exec(resetSQLString[mysqlResetUse], tokenDigest(ticket))
+	if err != nil {
+		return err
+	}
+
+	err = setPwd(tx, aid, hash)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(sessionSQLString[mysqlSessionRevokeByAdmin], aid)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	return err
+}
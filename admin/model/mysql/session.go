@@ -0,0 +1,157 @@
+package mysql
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+const (
+	mysqlSessionCreateTable = iota
+	mysqlSessionInsert
+	mysqlSessionGetByToken
+	mysqlSessionRotate
+	mysqlSessionRevoke
+	mysqlSessionRevokeByAdmin
+	mysqlSessionIsValid
+)
+
+var (
+	errInvalidRefreshToken = errors.New("invalid or expired refresh token")
+
+	sessionSQLString = []string{
+		`CREATE TABLE IF NOT EXISTS admin.session(
+			id            BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+			admin_id      BIGINT UNSIGNED NOT NULL,
+			token         CHAR(64) UNIQUE NOT NULL,
+			revoked       BOOLEAN DEFAULT FALSE,
+			expires_at    DATETIME NOT NULL,
+			created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(id),
+			INDEX(admin_id)
+		) ENGINE=InnoDB AUTO_INCREMENT=1000 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;`,
+		`INSERT INTO admin.session(admin_id,token,expires_at)VALUES(?,?,?)`,
+		`SELECT id,admin_id FROM admin.session WHERE token = ? AND revoked = false AND expires_at > ? FOR UPDATE`,
+		`UPDATE admin.session SET token = ?, expires_at = ? WHERE id = ? LIMIT 1`,
+		`UPDATE admin.session SET revoked = true WHERE id = ? LIMIT 1`,
+		`UPDATE admin.session SET revoked = true WHERE admin_id = ? AND revoked = false`,
+		`SELECT COUNT(*) FROM admin.session WHERE id = ? AND revoked = false AND expires_at > ? LOCK IN SHARE MODE`,
+	}
+)
+
+// CreateSessionTable create session table, a session is a login that holds a refresh token
+func CreateSessionTable(db *sql.DB) error {
+	_, err := db.Exec(sessionSQLString[mysqlSessionCreateTable])
+	return err
+}
+
+// CreateSession start a new session for admin and return session id and refresh token
+func CreateSession(db *sql.DB, aid uint32, ttl time.Duration) (uint64, string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return 0, "", err
+	}
+
+	result, err := db.Exec(sessionSQLString[mysqlSessionInsert], aid, tokenDigest(token), time.Now().Add(ttl))
+	if err != nil {
+		return 0, "", err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return 0, "", errInvalidMysql
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, "", err
+	}
+
+	return uint64(id), token, nil
+}
+
+// RotateSession exchange a refresh token for a new one, the old token can't be used again
+func RotateSession(db *sql.DB, token string, ttl time.Duration) (uint64, uint32, string, error) {
+	var (
+		sid uint64
+		aid uint32
+	)
+
+	next, err := randomToken()
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = tx.QueryRow(sessionSQLString[mysqlSessionGetByToken], tokenDigest(token), time.Now()).Scan(&sid, &aid)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			err = errInvalidRefreshToken
+		}
+		return 0, 0, "", err
+	}
+
+	_, err = tx.Exec(sessionSQLString[mysqlSessionRotate], tokenDigest(next), time.Now().Add(ttl), sid)
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, 0, "", err
+	}
+
+	return sid, aid, next, nil
+}
+
+// RevokeSession revoke session by id
+func RevokeSession(db *sql.DB, sid uint64) error {
+	_, err := db.Exec(sessionSQLString[mysqlSessionRevoke], sid)
+	return err
+}
+
+// RevokeSessionsByAdmin revoke all the sessions of the specified admin
+func RevokeSessionsByAdmin(db *sql.DB, aid uint32) error {
+	_, err := db.Exec(sessionSQLString[mysqlSessionRevokeByAdmin], aid)
+	return err
+}
+
+// IsSessionValid report whether the session is neither revoked nor expired
+func IsSessionValid(db *sql.DB, sid uint64) (bool, error) {
+	var count int
+
+	err := db.QueryRow(sessionSQLString[mysqlSessionIsValid], sid, time.Now()).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// randomToken generate a random token such as refresh token
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// tokenDigest only the digest of a token is stored in database
+func tokenDigest(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,200 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+)
+
+const (
+	mysqlTOTPCreateTable = iota
+	mysqlRecoveryCreateTable
+	mysqlTOTPUpsert
+	mysqlTOTPGet
+	mysqlTOTPEnable
+	mysqlTOTPDisable
+	mysqlTOTPUseStep
+	mysqlRecoveryDelete
+	mysqlRecoveryInsert
+	mysqlRecoveryUse
+)
+
+// TOTP -
+type TOTP struct {
+	AdminID  uint32
+	Secret   string
+	Enabled  bool
+	LastStep int64
+}
+
+var (
+	errTOTPEnabled        = errors.New("two-factor authentication has been enabled")
+	errTOTPCodeUsed       = errors.New("the one-time password has been used")
+	errInvalidRecoveryKey = errors.New("invalid recovery code")
+
+	totpSQLString = []string{
+		`CREATE TABLE IF NOT EXISTS admin.totp(
+			admin_id      BIGINT UNSIGNED NOT NULL,
+			secret        VARCHAR(64) NOT NULL,
+			enabled       BOOLEAN DEFAULT FALSE,
+			last_step     BIGINT NOT NULL DEFAULT 0,
+			created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(admin_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;`,
+		`CREATE TABLE IF NOT EXISTS admin.recovery(
+			admin_id      BIGINT UNSIGNED NOT NULL,
+			code          CHAR(64) NOT NULL,
+			used          BOOLEAN DEFAULT FALSE,
+			created_at    DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(admin_id,code)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;`,
+		`INSERT INTO admin.totp(admin_id,secret)VALUES(?,?) ON DUPLICATE KEY UPDATE secret = VALUES(secret), last_step = 0`,
+		`SELECT admin_id,secret,enabled,last_step FROM admin.totp WHERE admin_id = ? LOCK IN SHARE MODE`,
+		`UPDATE admin.totp SET enabled = true WHERE admin_id = ? LIMIT 1`,
+		`DELETE FROM admin.totp WHERE admin_id = ? LIMIT 1`,
+		`UPDATE admin.totp SET last_step = ? WHERE admin_id = ? AND last_step < ? LIMIT 1`,
+		`DELETE FROM admin.recovery WHERE admin_id = ?`,
+		`INSERT INTO admin.recovery(admin_id,code)VALUES(?,?)`,
+		`UPDATE admin.recovery SET used = true WHERE admin_id = ? AND code = ? AND used = false LIMIT 1`,
+	}
+)
+
+// CreateTOTPTable create totp and recovery code table
+func CreateTOTPTable(db *sql.DB) error {
+	_, err := db.Exec(totpSQLString[mysqlTOTPCreateTable])
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(totpSQLString[mysqlRecoveryCreateTable])
+	return err
+}
+
+// CreateTOTP save a new secret for admin, the secret is not enabled before confirmed.
+// Enrolling an enabled admin again is rejected.
+func CreateTOTP(db *sql.DB, aid uint32, secret string) error {
+	totp, err := GetTOTP(db, aid)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	if err == nil && totp.Enabled {
+		return errTOTPEnabled
+	}
+
+	_, err = db.Exec(totpSQLString[mysqlTOTPUpsert], aid, secret)
+	return err
+}
+
+// GetTOTP get totp information by admin id
+func GetTOTP(db *sql.DB, aid uint32) (*TOTP, error) {
+	var totp TOTP
+
+	err := db.QueryRow(totpSQLString[mysqlTOTPGet], aid).Scan(&totp.AdminID, &totp.Secret, &totp.Enabled, &totp.LastStep)
+	if err != nil {
+		return nil, err
+	}
+
+	return &totp, nil
+}
+
+// TOTPEnabled report whether admin has enabled two-factor authentication
+func TOTPEnabled(db *sql.DB, aid uint32) (bool, error) {
+	totp, err := GetTOTP(db, aid)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return totp.Enabled, nil
+}
+
+// EnableTOTP enable two-factor authentication and replace the recovery codes by digests
+func EnableTOTP(db *sql.DB, aid uint32, codes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec(totpSQLString[mysqlTOTPEnable], aid)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(totpSQLString[mysqlRecoveryDelete], aid)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range codes {
+		_, err = tx.Exec(totpSQLString[mysqlRecoveryInsert], aid, tokenDigest(code))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+// DisableTOTP remove the secret and recovery codes of admin
+func DisableTOTP(db *sql.DB, aid uint32) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec(totpSQLString[mysqlTOTPDisable], aid)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(totpSQLString[mysqlRecoveryDelete], aid)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+// UseTOTPStep record the time step of an accepted one-time password, a step can only be used once
+func UseTOTPStep(db *sql.DB, aid uint32, step int64) error {
+	result, err := db.Exec(totpSQLString[mysqlTOTPUseStep], step, aid, step)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errTOTPCodeUsed
+	}
+
+	return nil
+}
+
+// UseRecoveryCode consume a recovery code of admin
+func UseRecoveryCode(db *sql.DB, aid uint32, code string) error {
+	result, err := db.Exec(totpSQLString[mysqlRecoveryUse], aid, tokenDigest(code))
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errInvalidRecoveryKey
+	}
+
+	return nil
+}
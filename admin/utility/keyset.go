@@ -0,0 +1,247 @@
+package utility
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	jwt "gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+const (
+	keyFileExt = ".pem"
+
+	errFmtKeyFile = "%s: %v"
+)
+
+var (
+	errNoSigningKey     = errors.New("no private key to sign tokens")
+	errUnknownKeyID     = errors.New("unknown key id")
+	errUnsupportedKey   = errors.New("unsupported key, only RSA and P-256 EC keys are allowed")
+	errKeyAlgorithm     = errors.New("signing algorithm does not match the key")
+	errInvalidPEMBlock  = errors.New("no PEM block found")
+	errUnsupportedCurve = errors.New("unsupported elliptic curve")
+)
+
+// SigningKey is a key of the key set, Private is nil for a verify-only key
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   interface{}
+	Public    interface{}
+}
+
+// KeySet holds the keys to sign and verify access tokens, identified by kid.
+//
+// Keys are loaded from the *.pem files of a directory and the file name without
+// extension is the kid. RSA keys sign with RS256 and P-256 EC keys with ES256.
+// A file may hold a private key or only a public key, the private key whose kid
+// sorts last signs new tokens, all the keys verify.
+//
+// Rotate by adding a new private key with a greater kid (e.g. a date) and calling
+// Reload. Keep the old file, or replace it with its public key, until the tokens
+// signed by it have expired, then remove it and Reload again.
+type KeySet struct {
+	dir string
+
+	mu      sync.RWMutex
+	keys    map[string]*SigningKey
+	signing *SigningKey
+}
+
+// LoadKeySet load the keys in dir
+func LoadKeySet(dir string) (*KeySet, error) {
+	ks := &KeySet{dir: dir}
+
+	if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// Reload read the key directory again, the key set is unchanged on error
+func (ks *KeySet) Reload() error {
+	files, err := filepath.Glob(filepath.Join(ks.dir, "*"+keyFileExt))
+	if err != nil {
+		return err
+	}
+
+	sort.Strings(files)
+
+	var (
+		keys    = make(map[string]*SigningKey)
+		signing *SigningKey
+	)
+
+	for _, file := range files {
+		key, err := loadKey(file)
+		if err != nil {
+			return fmt.Errorf(errFmtKeyFile, file, err)
+		}
+
+		keys[key.ID] = key
+
+		if key.Private != nil {
+			signing = key
+		}
+	}
+
+	if signing == nil {
+		return errNoSigningKey
+	}
+
+	ks.mu.Lock()
+	ks.keys = keys
+	ks.signing = signing
+	ks.mu.Unlock()
+
+	return nil
+}
+
+// Sign sign claims with the current signing key and set kid in header
+func (ks *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	ks.mu.RLock()
+	key := ks.signing
+	ks.mu.RUnlock()
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(key.Algorithm), claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Private)
+}
+
+// Keyfunc look up the verification key of token by kid, it is used with jwt.Parse
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	ks.mu.RLock()
+	key, ok := ks.keys[kid]
+	ks.mu.RUnlock()
+
+	if !ok {
+		return nil, errUnknownKeyID
+	}
+
+	if token.Method.Alg() != key.Algorithm {
+		return nil, errKeyAlgorithm
+	}
+
+	return key.Public, nil
+}
+
+// JWKS return all the public keys as a JSON Web Key Set
+func (ks *KeySet) JWKS() map[string]interface{} {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	kids := make([]string, 0, len(ks.keys))
+	for kid := range ks.keys {
+		kids = append(kids, kid)
+	}
+
+	sort.Strings(kids)
+
+	keys := make([]map[string]string, 0, len(kids))
+	for _, kid := range kids {
+		keys = append(keys, jwk(ks.keys[kid]))
+	}
+
+	return map[string]interface{}{"keys": keys}
+}
+
+func jwk(key *SigningKey) map[string]string {
+	result := map[string]string{
+		"kid": key.ID,
+		"alg": key.Algorithm,
+		"use": "sig",
+	}
+
+	switch pub := key.Public.(type) {
+	case *rsa.PublicKey:
+		result["kty"] = "RSA"
+		result["n"] = base64URL(pub.N.Bytes())
+		result["e"] = base64URL(big.NewInt(int64(pub.E)).Bytes())
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+
+		result["kty"] = "EC"
+		result["crv"] = pub.Curve.Params().Name
+		result["x"] = base64URL(padLeft(pub.X.Bytes(), size))
+		result["y"] = base64URL(padLeft(pub.Y.Bytes(), size))
+	}
+
+	return result
+}
+
+func base64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func padLeft(b []byte, size int) []byte {
+	if len(b) >= size {
+		return b
+	}
+
+	return append(make([]byte, size-len(b)), b...)
+}
+
+// loadKey parse a PEM file holding an RSA or EC private key, or only its public key
+func loadKey(file string) (*SigningKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errInvalidPEMBlock
+	}
+
+	key := &SigningKey{
+		ID: strings.TrimSuffix(filepath.Base(file), keyFileExt),
+	}
+
+	if strings.Contains(block.Type, "PUBLIC KEY") {
+		if key.Public, err = jwt.ParseRSAPublicKeyFromPEM(data); err != nil {
+			if key.Public, err = jwt.ParseECPublicKeyFromPEM(data); err != nil {
+				return nil, errUnsupportedKey
+			}
+		}
+	} else {
+		if key.Private, err = jwt.ParseRSAPrivateKeyFromPEM(data); err != nil {
+			if key.Private, err = jwt.ParseECPrivateKeyFromPEM(data); err != nil {
+				return nil, errUnsupportedKey
+			}
+		}
+
+		switch private := key.Private.(type) {
+		case *rsa.PrivateKey:
+			key.Public = &private.PublicKey
+		case *ecdsa.PrivateKey:
+			key.Public = &private.PublicKey
+		}
+	}
+
+	switch pub := key.Public.(type) {
+	case *rsa.PublicKey:
+		key.Algorithm = jwt.SigningMethodRS256.Alg()
+	case *ecdsa.PublicKey:
+		if pub.Curve != elliptic.P256() {
+			return nil, errUnsupportedCurve
+		}
+		key.Algorithm = jwt.SigningMethodES256.Alg()
+	}
+
+	return key, nil
+}
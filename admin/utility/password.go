@@ -0,0 +1,126 @@
+package utility
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxPasswordBytes - bcrypt ignores the bytes after it
+	MaxPasswordBytes = 72
+
+	pwdMinLength = "password must contain at least %d characters"
+	pwdMaxLength = "password can't contain more than %d characters"
+)
+
+var (
+	errPwdUpper    = errors.New("password must contain an upper case letter")
+	errPwdLower    = errors.New("password must contain a lower case letter")
+	errPwdDigit    = errors.New("password must contain a digit")
+	errPwdSymbol   = errors.New("password must contain a symbol")
+	errPwdBlocked  = errors.New("password is too common or has been breached")
+	errPwdTooLong  = fmt.Errorf("password can't be longer than %d bytes", MaxPasswordBytes)
+	errPwdNotPrint = errors.New("password contains invisible characters")
+)
+
+// PasswordValidator checks a new password before it is hashed
+type PasswordValidator interface {
+	Validate(pwd string) error
+}
+
+// PasswordPolicy is the default PasswordValidator
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+
+	blocklist map[string]bool
+}
+
+// LoadBlocklist read breached or common passwords from file, one password per line
+func (p *PasswordPolicy) LoadBlocklist(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	blocklist := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			blocklist[strings.ToLower(line)] = true
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	p.blocklist = blocklist
+	return nil
+}
+
+// Validate check length, character classes and blocklist of password
+func (p *PasswordPolicy) Validate(pwd string) error {
+	var (
+		upper, lower, digit, symbol bool
+
+		length = 0
+	)
+
+	if len(pwd) > MaxPasswordBytes {
+		return errPwdTooLong
+	}
+
+	for _, r := range pwd {
+		switch {
+		case !unicode.IsPrint(r):
+			return errPwdNotPrint
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+		length++
+	}
+
+	if length < p.MinLength {
+		return fmt.Errorf(pwdMinLength, p.MinLength)
+	}
+
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf(pwdMaxLength, p.MaxLength)
+	}
+
+	switch {
+	case p.RequireUpper && !upper:
+		return errPwdUpper
+	case p.RequireLower && !lower:
+		return errPwdLower
+	case p.RequireDigit && !digit:
+		return errPwdDigit
+	case p.RequireSymbol && !symbol:
+		return errPwdSymbol
+	}
+
+	if p.blocklist[strings.ToLower(pwd)] {
+		return errPwdBlocked
+	}
+
+	return nil
+}
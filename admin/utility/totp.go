@@ -0,0 +1,109 @@
+package utility
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"net/url"
+	"time"
+)
+
+const (
+	// TOTPDigits - length of a one-time password
+	TOTPDigits = 6
+
+	// TOTPPeriod - seconds of a time step
+	TOTPPeriod = 30
+
+	// TOTPSkew - number of time steps accepted before and after the current one
+	TOTPSkew = 1
+
+	// RecoveryCodeCount - number of recovery codes generated on enrollment
+	RecoveryCodeCount = 10
+
+	secretSize       = 20
+	recoveryCodeSize = 5
+)
+
+var (
+	b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+// GenerateSecret return a random base32 encoded TOTP secret
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretSize)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return b32.EncodeToString(b), nil
+}
+
+// OTPAuthURI return the otpauth URI that authenticator apps import
+func OTPAuthURI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(TOTPDigits))
+	v.Set("period", fmt.Sprint(TOTPPeriod))
+
+	return "otpauth://totp/" + url.PathEscape(issuer+":"+account) + "?" + v.Encode()
+}
+
+// ValidateTOTP check code against secret at time t as RFC 6238 describes,
+// return the matched time step so that a code can't be used twice
+func ValidateTOTP(secret, code string, t time.Time) (int64, bool) {
+	key, err := b32.DecodeString(secret)
+	if err != nil || len(code) != TOTPDigits {
+		return 0, false
+	}
+
+	current := t.Unix() / TOTPPeriod
+
+	for step := current - TOTPSkew; step <= current+TOTPSkew; step++ {
+		if hmac.Equal([]byte(hotp(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
+
+// hotp compute a one-time password as RFC 4226 describes
+func hotp(key []byte, counter int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", TOTPDigits, value%uint32(math.Pow10(TOTPDigits)))
+}
+
+// RecoveryCodes return n random recovery codes
+func RecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+
+	for i := range codes {
+		b := make([]byte, recoveryCodeSize)
+
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+
+		codes[i] = hex.EncodeToString(b)
+	}
+
+	return codes, nil
+}
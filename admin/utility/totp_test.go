@@ -0,0 +1,77 @@
+package utility
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the base32 encoding of the key "12345678901234567890" of RFC 4226 and RFC 6238
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestHOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	// RFC 4226 appendix D
+	tests := []struct {
+		counter int64
+		want    string
+	}{
+		{0, "755224"},
+		{1, "287082"},
+		{2, "359152"},
+		{3, "969429"},
+		{4, "338314"},
+		{5, "254676"},
+		{6, "287922"},
+		{7, "162583"},
+		{8, "399871"},
+		{9, "520489"},
+	}
+
+	for _, tt := range tests {
+		if got := hotp(key, tt.counter); got != tt.want {
+			t.Errorf("hotp(%d) = %s, want %s", tt.counter, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	// RFC 6238 appendix B, the last 6 digits of the SHA1 codes
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		at     int64
+		step   int64
+		ok     bool
+	}{
+		{"rfc 59", rfcSecret, "287082", 59, 1, true},
+		{"rfc 1111111109", rfcSecret, "081804", 1111111109, 37037036, true},
+		{"rfc 1111111111", rfcSecret, "050471", 1111111111, 37037037, true},
+		{"rfc 1234567890", rfcSecret, "005924", 1234567890, 41152263, true},
+		{"rfc 2000000000", rfcSecret, "279037", 2000000000, 66666666, true},
+		{"previous step", rfcSecret, "287082", 59 + TOTPPeriod, 1, true},
+		{"next step", rfcSecret, "287082", 59 - TOTPPeriod, 1, true},
+		{"beyond skew", rfcSecret, "287082", 59 + 2*TOTPPeriod, 0, false},
+		{"wrong code", rfcSecret, "287083", 59, 0, false},
+		{"short code", rfcSecret, "28708", 59, 0, false},
+		{"long code", rfcSecret, "2870820", 59, 0, false},
+		{"invalid secret", "not base32!", "287082", 59, 0, false},
+	}
+
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(tt.secret, tt.code, time.Unix(tt.at, 0))
+		if ok != tt.ok || step != tt.step {
+			t.Errorf("%s: ValidateTOTP = (%d, %v), want (%d, %v)", tt.name, step, ok, tt.step, tt.ok)
+		}
+	}
+}
+
+func TestOTPAuthURI(t *testing.T) {
+	got := OTPAuthURI("Miuer", "root", rfcSecret)
+	want := "otpauth://totp/Miuer:root?algorithm=SHA1&digits=6&issuer=Miuer&period=30&secret=" + rfcSecret
+
+	if got != want {
+		t.Errorf("OTPAuthURI = %s, want %s", got, want)
+	}
+}
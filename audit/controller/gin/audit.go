@@ -0,0 +1,190 @@
+package gin
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Mictrlan/Miuer/audit/model/mysql"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// RequestIDHeader is the header of request id, it is generated unless the client sets it
+	RequestIDHeader = "X-Request-ID"
+
+	// entryKey is the context key of the request part of entries
+	entryKey = "audit_entry"
+
+	maxRequestID    = 64
+	defaultPageSize = 20
+)
+
+var errServerNotExists = errors.New("[RegisterRouter]: server is nil")
+
+// AuditController -
+type AuditController struct {
+	db *sql.DB
+}
+
+// New create new AuditController
+func New(db *sql.DB) *AuditController {
+	return &AuditController{
+		db: db,
+	}
+}
+
+// Register register audit router
+func (ac *AuditController) Register(r gin.IRouter) {
+	if r == nil {
+		log.Fatal(errServerNotExists)
+	}
+
+	if err := mysql.CreateDB(ac.db); err != nil {
+		log.Fatal(err)
+	}
+
+	if err := mysql.CreateTable(ac.db); err != nil {
+		log.Fatal(err)
+	}
+
+	r.POST("/api/v1/audit/list", ac.list)
+}
+
+// Track return a middleware that identifies the request for the entries recorded by it,
+// the actor is taken from GetUID and is 0 when GetUID fails. GetUID returns the impersonated
+// admin under impersonation, the real admin is taken from GetImpersonator.
+func Track(GetUID func(Context *gin.Context) (uint32, error), GetImpersonator func(ctx *gin.Context) (uint32, bool)) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader(RequestIDHeader)
+		if requestID == "" || len(requestID) > maxRequestID {
+			requestID = newRequestID()
+		}
+
+		ctx.Header(RequestIDHeader, requestID)
+
+		actor, _ := GetUID(ctx)
+		impersonator, _ := GetImpersonator(ctx)
+
+		ctx.Set(entryKey, mysql.Entry{
+			ActorID:        actor,
+			ImpersonatorID: impersonator,
+			IP:             ctx.ClientIP(),
+			RequestID:      requestID,
+		})
+	}
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// NewEntry return a new entry of the request for a model function to describe and record,
+// it is nil when the request is not tracked so that nothing is recorded.
+func NewEntry(ctx *gin.Context) *mysql.Entry {
+	v, exists := ctx.Get(entryKey)
+	if !exists {
+		return nil
+	}
+
+	e, ok := v.(mysql.Entry)
+	if !ok {
+		return nil
+	}
+
+	return &e
+}
+
+// list lists the entries by page, filtered by actor, impersonator, action, target, request id and the
+// RFC 3339 time range [from, to)
+func (ac *AuditController) list(ctx *gin.Context) {
+	var (
+		req struct {
+			ActorID        uint32 `json:"actor_id"`
+			ImpersonatorID uint32 `json:"impersonator_id"`
+			Action         string `json:"action"      binding:"max=64"`
+			TargetType     string `json:"target_type" binding:"max=64"`
+			TargetID       string `json:"target_id"   binding:"max=128"`
+			RequestID      string `json:"request_id"  binding:"max=64"`
+			From           string `json:"from"`
+			To             string `json:"to"`
+			Page           uint32 `json:"page"`
+			Size           uint32 `json:"size"        binding:"max=100"`
+		}
+	)
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	filter := &mysql.Filter{
+		ActorID:        req.ActorID,
+		ImpersonatorID: req.ImpersonatorID,
+		Action:         req.Action,
+		TargetType:     req.TargetType,
+		TargetID:       req.TargetID,
+		RequestID:      req.RequestID,
+	}
+
+	if filter.From, err = parseTime(req.From); err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if filter.To, err = parseTime(req.To); err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if req.Page == 0 {
+		req.Page = 1
+	}
+
+	if req.Size == 0 {
+		req.Size = defaultPageSize
+	}
+
+	entries, total, err := mysql.List(ac.db, filter, (req.Page-1)*req.Size, req.Size)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"entries": entries,
+		"total":   total,
+		"page":    req.Page,
+		"size":    req.Size,
+	})
+}
+
+// parseTime parse an optional RFC 3339 time, empty means no bound
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,224 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	mysqlAuditCreateDatabase = iota
+	mysqlAuditCreateTable
+	mysqlAuditInsert
+	mysqlAuditList
+	mysqlAuditCount
+)
+
+type (
+	// Entry is a privileged change, Before and After are the JSON states of target, the empty
+	// Before means created and the empty After means deleted. ActorID is 0 for the system.
+	// ImpersonatorID is the real admin when ActorID is impersonated, otherwise 0.
+	Entry struct {
+		ID             uint64
+		ActorID        uint32
+		ImpersonatorID uint32
+		Action         string
+		TargetType     string
+		TargetID       string
+		Before         string
+		After          string
+		IP             string
+		RequestID      string
+		CreatedAt      string
+	}
+
+	// Filter of entries, the zero fields match any entry
+	Filter struct {
+		ActorID        uint32
+		ImpersonatorID uint32
+		Action         string
+		TargetType     string
+		TargetID       string
+		RequestID      string
+		From           *time.Time
+		To             *time.Time
+	}
+
+	// Execer is *sql.DB or *sql.Tx
+	Execer interface {
+		Exec(query string, args ...interface{}) (sql.Result, error)
+	}
+)
+
+var (
+	auditSQLString = []string{
+		`CREATE DATABASE IF NOT EXISTS audit`,
+		`CREATE TABLE IF NOT EXISTS audit.log(
+			id              BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+			actor_id        BIGINT UNSIGNED NOT NULL,
+			impersonator_id BIGINT UNSIGNED NOT NULL DEFAULT 0,
+			action          VARCHAR(64) NOT NULL,
+			target_type     VARCHAR(64) NOT NULL,
+			target_id       VARCHAR(128) NOT NULL DEFAULT ' ',
+			before_state    MEDIUMTEXT NULL,
+			after_state     MEDIUMTEXT NULL,
+			ip              VARCHAR(64) NOT NULL DEFAULT ' ',
+			request_id      VARCHAR(64) NOT NULL DEFAULT ' ',
+			created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY(id),
+			INDEX(actor_id),
+			INDEX(impersonator_id),
+			INDEX(target_type,target_id),
+			INDEX(request_id),
+			INDEX(created_at)
+		) ENGINE=InnoDB AUTO_INCREMENT=1000 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;`,
+		`INSERT INTO audit.log(actor_id,impersonator_id,action,target_type,target_id,before_state,after_state,ip,request_id,created_at) VALUES (?,?,?,?,?,?,?,?,?,?)`,
+		`SELECT id,actor_id,impersonator_id,action,target_type,target_id,before_state,after_state,ip,request_id,created_at FROM audit.log WHERE (? = 0 OR actor_id = ?) AND (? = 0 OR impersonator_id = ?) AND (? = '' OR action = ?) AND (? = '' OR target_type = ?) AND (? = '' OR target_id = ?) AND (? = '' OR request_id = ?) AND (? IS NULL OR created_at >= ?) AND (? IS NULL OR created_at < ?) ORDER BY id DESC LIMIT ?,? LOCK IN SHARE MODE`,
+		`SELECT COUNT(*) FROM audit.log WHERE (? = 0 OR actor_id = ?) AND (? = 0 OR impersonator_id = ?) AND (? = '' OR action = ?) AND (? = '' OR target_type = ?) AND (? = '' OR target_id = ?) AND (? = '' OR request_id = ?) AND (? IS NULL OR created_at >= ?) AND (? IS NULL OR created_at < ?) LOCK IN SHARE MODE`,
+	}
+)
+
+// CreateDB create audit database
+func CreateDB(db *sql.DB) error {
+	_, err := db.Exec(auditSQLString[mysqlAuditCreateDatabase])
+	return err
+}
+
+// CreateTable create audit log table
+func CreateTable(db *sql.DB) error {
+	_, err := db.Exec(auditSQLString[mysqlAuditCreateTable])
+	return err
+}
+
+// Describe set the action and target of entry and return it, nothing is done to a nil entry
+func (e *Entry) Describe(action, targetType string, targetID interface{}) *Entry {
+	if e == nil {
+		return nil
+	}
+
+	e.Action = action
+	e.TargetType = targetType
+	e.TargetID = fmt.Sprint(targetID)
+
+	return e
+}
+
+// Change set the states of target before and after the change as JSON, nil means no state
+func (e *Entry) Change(before, after interface{}) error {
+	if e == nil {
+		return nil
+	}
+
+	var err error
+
+	if e.Before, err = marshal(before); err != nil {
+		return err
+	}
+
+	e.After, err = marshal(after)
+	return err
+}
+
+func marshal(v interface{}) (string, error) {
+	if v == nil {
+		return "", nil
+	}
+
+	b, err := json.Marshal(v)
+	return string(b), err
+}
+
+func nullable(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+
+	return value
+}
+
+// Record write entry by ex, which is the transaction of the change whenever possible.
+// Nothing is written for a nil entry or an entry not described, e.g. nothing was changed.
+func Record(ex Execer, e *Entry) error {
+	if e == nil || e.Action == "" {
+		return nil
+	}
+
+	_, err := ex.Exec(auditSQLString[mysqlAuditInsert], e.ActorID, e.ImpersonatorID, e.Action, e.TargetType, e.TargetID, nullable(e.Before), nullable(e.After), e.IP, e.RequestID, time.Now())
+	return err
+}
+
+// Transact run change in a transaction and record entry in the same transaction,
+// change describes entry when it changes something
+func Transact(db *sql.DB, e *Entry, change func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = change(tx)
+	if err != nil {
+		return err
+	}
+
+	err = Record(tx, e)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+// List lists the entries matching filter by page from the latest one and the total count
+func List(db *sql.DB, f *Filter, offset, limit uint32) ([]*Entry, uint32, error) {
+	var (
+		total   uint32
+		entries []*Entry
+
+		args = []interface{}{
+			f.ActorID, f.ActorID,
+			f.ImpersonatorID, f.ImpersonatorID,
+			f.Action, f.Action,
+			f.TargetType, f.TargetType,
+			f.TargetID, f.TargetID,
+			f.RequestID, f.RequestID,
+			f.From, f.From,
+			f.To, f.To,
+		}
+	)
+
+	err := db.QueryRow(auditSQLString[mysqlAuditCount], args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(auditSQLString[mysqlAuditList], append(args, offset, limit)...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			e             Entry
+			before, after sql.NullString
+		)
+
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.ImpersonatorID, &e.Action, &e.TargetType, &e.TargetID, &before, &after, &e.IP, &e.RequestID, &e.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+
+		e.Before, e.After = before.String, after.String
+		entries = append(entries, &e)
+	}
+
+	return entries, total, rows.Err()
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"time"
 
+	audit "github.com/Mictrlan/Miuer/audit/controller/gin"
 	"github.com/Mictrlan/Miuer/banner/model/mysql"
 
 	"github.com/gin-gonic/gin"
@@ -65,7 +66,7 @@ func (bc *BannerController) insert(ctx *gin.Context) {
 		return
 	}
 
-	id, err := mysql.InsertBanner(bc.db, &banner.Name, &banner.ImagePath, &banner.Event, &banner.StartDate, &banner.EndDate)
+	id, err := mysql.InsertBanner(bc.db, &banner.Name, &banner.ImagePath, &banner.Event, &banner.StartDate, &banner.EndDate, audit.NewEntry(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
@@ -146,7 +147,7 @@ func (bc *BannerController) deleteByID(ctx *gin.Context) {
 		return
 	}
 
-	err = mysql.DeleteByID(bc.db, banner.ID)
+	err = mysql.DeleteByID(bc.db, banner.ID, audit.NewEntry(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"errors"
 	"time"
+
+	audit "github.com/Mictrlan/Miuer/audit/model/mysql"
 )
 
 const (
@@ -15,6 +17,14 @@ const (
 	mysqlBannerDeleteByID
 )
 
+// actions and target types of the audit entries recorded by banner
+const (
+	auditBannerCreate = "banner.create"
+	auditBannerDelete = "banner.delete"
+
+	auditTargetBanner = "banner"
+)
+
 // Banner -
 type Banner struct {
 	BannerID  int
@@ -58,18 +68,36 @@ func CreateTable(db *sql.DB) error {
 	return err
 }
 
-// InsertBanner add banner information and return bannerId
-func InsertBanner(db *sql.DB, name, imagepath, event *string, startdate, enddate *time.Time) (uint32, error) {
-	result, err := db.Exec(bannerSQLString[mysqlBannerInsert], name, imagepath, event, startdate, enddate)
-	if err != nil {
-		return 0, err
-	}
+// InsertBanner add banner information and return bannerId, entry is recorded in the same transaction.
+func InsertBanner(db *sql.DB, name, imagepath, event *string, startdate, enddate *time.Time, entry *audit.Entry) (uint32, error) {
+	var bannerID int64
 
-	if affected, _ := result.RowsAffected(); affected == 0 {
-		return 0, errInvalidInsert
-	}
+	err := audit.Transact(db, entry, func(tx *sql.Tx) error {
+		result, err := tx.Exec(bannerSQLString[mysqlBannerInsert], name, imagepath, event, startdate, enddate)
+		if err != nil {
+			return err
+		}
+
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return errInvalidInsert
+		}
 
-	bannerID, err := result.LastInsertId()
+		bannerID, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		after := &Banner{
+			BannerID:  int(bannerID),
+			Name:      *name,
+			ImagePath: *imagepath,
+			Event:     *event,
+			StartDate: startdate.Format(time.RFC3339),
+			EndDate:   enddate.Format(time.RFC3339),
+		}
+
+		return entry.Describe(auditBannerCreate, auditTargetBanner, bannerID).Change(nil, after)
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -137,8 +165,25 @@ func InfoByID(db *sql.DB, id int) (*Banner, error) {
 	return &ban, nil
 }
 
-// DeleteByID delete banner by id
-func DeleteByID(db *sql.DB, id int) error {
-	_, err := db.Exec(bannerSQLString[mysqlBannerDeleteByID], id)
-	return err
+// DeleteByID delete banner by id, entry is recorded in the same transaction.
+func DeleteByID(db *sql.DB, id int, entry *audit.Entry) error {
+	return audit.Transact(db, entry, func(tx *sql.Tx) error {
+		var before Banner
+
+		err := tx.QueryRow(bannerSQLString[mysqlBannerInfoByID], id).Scan(&before.BannerID, &before.Name, &before.ImagePath, &before.Event, &before.StartDate, &before.EndDate)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(bannerSQLString[mysqlBannerDeleteByID], id)
+		if err != nil {
+			return err
+		}
+
+		return entry.Describe(auditBannerDelete, auditTargetBanner, id).Change(&before, nil)
+	})
 }
@@ -6,6 +6,7 @@ import (
 	"log"
 	"net/http"
 
+	audit "github.com/Mictrlan/Miuer/audit/controller/gin"
 	"github.com/Mictrlan/Miuer/category/model/mysql"
 
 	"github.com/gin-gonic/gin"
@@ -18,14 +19,17 @@ type CateController struct {
 	db        *sql.DB
 	dBName    string
 	tableName string
+	scope     func(ctx *gin.Context) []uint64
 }
 
-// New create new CateController
-func New(db *sql.DB, dB string, table string) *CateController {
+// New create new CateController, scope return the categories under which the admin can see,
+// nil means all the categories
+func New(db *sql.DB, dB string, table string, scope func(ctx *gin.Context) []uint64) *CateController {
 	return &CateController{
 		db:        db,
 		dBName:    dB,
 		tableName: table,
+		scope:     scope,
 	}
 }
 
@@ -75,7 +79,7 @@ func (cc *CateController) insert(ctx *gin.Context) {
 		return
 	}
 
-	id, err := mysql.InsertCategory(cc.db, cc.dBName, cc.tableName, category.ParentID, category.Name)
+	id, err := mysql.InsertCategory(cc.db, cc.dBName, cc.tableName, category.ParentID, category.Name, cc.scope(ctx), audit.NewEntry(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
@@ -103,7 +107,7 @@ func (cc *CateController) changeCategoryStatus(ctx *gin.Context) {
 		return
 	}
 
-	err = mysql.ChangeCategoryStatus(cc.db, cc.dBName, cc.tableName, category.Status, category.CategoryID)
+	err = mysql.ChangeCategoryStatus(cc.db, cc.dBName, cc.tableName, category.Status, category.CategoryID, cc.scope(ctx), audit.NewEntry(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
@@ -128,7 +132,7 @@ func (cc *CateController) changeCategoryName(ctx *gin.Context) {
 		return
 	}
 
-	err = mysql.ChangeCategoryName(cc.db, cc.dBName, cc.tableName, category.Name, category.CategoryID)
+	err = mysql.ChangeCategoryName(cc.db, cc.dBName, cc.tableName, category.Name, category.CategoryID, cc.scope(ctx), audit.NewEntry(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
@@ -152,7 +156,7 @@ func (cc *CateController) lisitChirldrenByParentID(ctx *gin.Context) {
 		return
 	}
 
-	categorys, err := mysql.LisitChirldrenByParentID(cc.db, cc.dBName, cc.tableName, category.ParentID)
+	categorys, err := mysql.LisitChirldrenByParentID(cc.db, cc.dBName, cc.tableName, category.ParentID, cc.scope(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
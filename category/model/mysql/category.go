@@ -4,6 +4,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+
+	audit "github.com/Mictrlan/Miuer/audit/model/mysql"
 )
 
 // Category -
@@ -22,11 +24,23 @@ const (
 	mysqlCategoryChangeStatus
 	mysqlCategoryChangeName
 	mysqlCategoryListChirdByParentID
+	mysqlCategoryParentByID
+	mysqlCategoryLockByID
+)
+
+// actions and target types of the audit entries recorded by category
+const (
+	auditCategoryCreate = "category.create"
+	auditCategoryStatus = "category.status"
+	auditCategoryName   = "category.name"
+
+	auditTargetCategory = "category"
 )
 
 var (
 	errInvaildInsert         = errors.New("insert comment: insert affected 0 rows")
 	errInvalidChangeCategory = errors.New("change status: affected 0 rows")
+	errCategoryScope         = errors.New("the category is out of data scope")
 
 	categorySQLString = []string{
 		`CREATE DATABASE IF NOT EXISTS %s`,
@@ -42,6 +56,8 @@ var (
 		`UPDATE %s.%s SET status = ? WHERE categoryId = ? LIMIT 1`,
 		`UPDATE %s.%s SET name = ? WHERE categoryId = ? LIMIT 1`,
 		`SELECT * FROM %s.%s WHERE parentId = ? LOCK IN SHARE MODE`,
+		`SELECT parentId FROM %s.%s WHERE categoryId = ? LOCK IN SHARE MODE`,
+		`SELECT categoryId,parentId,name,status,createTime FROM %s.%s WHERE categoryId = ? FOR UPDATE`,
 	}
 )
 
@@ -61,20 +77,91 @@ func CreateTable(db *sql.DB, dBName, tableName string) error {
 	return err
 }
 
-// InsertCategory add category info and return categoryid
-func InsertCategory(db *sql.DB, dBName, tableName string, parentID uint, name string) (uint, error) {
-	sql := fmt.Sprintf(categorySQLString[mysqlCategoryInsert], dBName, tableName)
+// checkScope return errCategoryScope unless the children of parentID are under a category of scope,
+// the empty scope means all the categories
+func checkScope(db *sql.DB, dBName, tableName string, parentID uint, scope []uint64) error {
+	if len(scope) == 0 {
+		return nil
+	}
+
+	var (
+		query   = fmt.Sprintf(categorySQLString[mysqlCategoryParentByID], dBName, tableName)
+		visited = make(map[uint]bool)
+	)
+
+	for id := parentID; id != 0 && !visited[id]; {
+		for _, root := range scope {
+			if uint64(id) == root {
+				return nil
+			}
+		}
+
+		visited[id] = true
 
-	result, err := db.Exec(sql, parentID, name)
+		var parent sql.NullInt64
+
+		err := db.QueryRow(query, id).Scan(&parent)
+		if err == sql.ErrNoRows {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		id = uint(parent.Int64)
+	}
+
+	return errCategoryScope
+}
+
+// checkCategoryScope return errCategoryScope unless the category is under a category of scope
+func checkCategoryScope(db *sql.DB, dBName, tableName string, categoryid uint, scope []uint64) error {
+	if len(scope) == 0 {
+		return nil
+	}
+
+	var parent sql.NullInt64
+
+	err := db.QueryRow(fmt.Sprintf(categorySQLString[mysqlCategoryParentByID], dBName, tableName), categoryid).Scan(&parent)
 	if err != nil {
-		return 0, err
+		return err
 	}
 
-	if affected, _ := result.RowsAffected(); affected == 0 {
-		return 0, errInvaildInsert
+	return checkScope(db, dBName, tableName, uint(parent.Int64), scope)
+}
+
+// InsertCategory add category info and return categoryid, the parent must be in scope.
+// entry is recorded in the same transaction.
+func InsertCategory(db *sql.DB, dBName, tableName string, parentID uint, name string, scope []uint64, entry *audit.Entry) (uint, error) {
+	var categoryID int64
+
+	if err := checkScope(db, dBName, tableName, parentID, scope); err != nil {
+		return 0, err
 	}
 
-	categoryID, err := result.LastInsertId()
+	err := audit.Transact(db, entry, func(tx *sql.Tx) error {
+		result, err := tx.Exec(fmt.Sprintf(categorySQLString[mysqlCategoryInsert], dBName, tableName), parentID, name)
+		if err != nil {
+			return err
+		}
+
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return errInvaildInsert
+		}
+
+		categoryID, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		after, err := lockCategory(tx, dBName, tableName, uint(categoryID))
+		if err != nil {
+			return err
+		}
+
+		return entry.Describe(auditCategoryCreate, auditTargetCategory, categoryID).Change(nil, after)
+	})
 	if err != nil {
 		return 0, err
 	}
@@ -82,40 +169,73 @@ func InsertCategory(db *sql.DB, dBName, tableName string, parentID uint, name st
 	return uint(categoryID), nil
 }
 
-// ChangeCategoryStatus change category status by categoryid
-func ChangeCategoryStatus(db *sql.DB, dBName, tableName string, status int8, categoryid uint) error {
-	sql := fmt.Sprintf(categorySQLString[mysqlCategoryChangeStatus], dBName, tableName)
-
-	result, err := db.Exec(sql, status, categoryid)
-	if err != nil {
+// ChangeCategoryStatus change category status by categoryid, the category must be in scope.
+// entry is recorded in the same transaction.
+func ChangeCategoryStatus(db *sql.DB, dBName, tableName string, status int8, categoryid uint, scope []uint64, entry *audit.Entry) error {
+	if err := checkCategoryScope(db, dBName, tableName, categoryid, scope); err != nil {
 		return err
 	}
 
-	if affected, _ := result.RowsAffected(); affected == 0 {
-		return errInvalidChangeCategory
+	return changeCategory(db, dBName, tableName, categoryid, entry.Describe(auditCategoryStatus, auditTargetCategory, categoryid), func(tx *sql.Tx, c *Category) (sql.Result, error) {
+		c.Status = status
+		return tx.Exec(fmt.Sprintf(categorySQLString[mysqlCategoryChangeStatus], dBName, tableName), status, categoryid)
+	})
+}
+
+// ChangeCategoryName change category name by categoryid, the category must be in scope.
+// entry is recorded in the same transaction.
+func ChangeCategoryName(db *sql.DB, dBName, tableName string, name string, categoryid uint, scope []uint64, entry *audit.Entry) error {
+	if err := checkCategoryScope(db, dBName, tableName, categoryid, scope); err != nil {
+		return err
 	}
 
-	return nil
+	return changeCategory(db, dBName, tableName, categoryid, entry.Describe(auditCategoryName, auditTargetCategory, categoryid), func(tx *sql.Tx, c *Category) (sql.Result, error) {
+		c.Name = name
+		return tx.Exec(fmt.Sprintf(categorySQLString[mysqlCategoryChangeName], dBName, tableName), name, categoryid)
+	})
 }
 
-// ChangeCategoryName change category name by categoryid
-func ChangeCategoryName(db *sql.DB, dBName, tableName string, name string, categoryid uint) error {
-	sql := fmt.Sprintf(categorySQLString[mysqlCategoryChangeName], dBName, tableName)
+// changeCategory run update on the locked category, update applies the change to the copy
+// of the category as well, which is recorded as the after state of the described entry
+func changeCategory(db *sql.DB, dBName, tableName string, categoryid uint, entry *audit.Entry, update func(*sql.Tx, *Category) (sql.Result, error)) error {
+	return audit.Transact(db, entry, func(tx *sql.Tx) error {
+		before, err := lockCategory(tx, dBName, tableName, categoryid)
+		if err == sql.ErrNoRows {
+			return errInvalidChangeCategory
+		}
 
-	result, err := db.Exec(sql, name, categoryid)
-	if err != nil {
-		return err
-	}
+		if err != nil {
+			return err
+		}
+
+		after := *before
+
+		result, err := update(tx, &after)
+		if err != nil {
+			return err
+		}
+
+		if affected, _ := result.RowsAffected(); affected == 0 {
+			return errInvalidChangeCategory
+		}
 
-	if affected, _ := result.RowsAffected(); affected == 0 {
-		return errInvalidChangeCategory
+		return entry.Change(before, &after)
+	})
+}
+
+func lockCategory(tx *sql.Tx, dBName, tableName string, categoryid uint) (*Category, error) {
+	var c Category
+
+	err := tx.QueryRow(fmt.Sprintf(categorySQLString[mysqlCategoryLockByID], dBName, tableName), categoryid).Scan(&c.CategoryID, &c.ParentID, &c.Name, &c.Status, &c.CreateTime)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	return &c, nil
 }
 
-// LisitChirldrenByParentID -
-func LisitChirldrenByParentID(db *sql.DB, dBName, tableName string, parentID uint) ([]*Category, error) {
+// LisitChirldrenByParentID - the parent must be in scope
+func LisitChirldrenByParentID(db *sql.DB, dBName, tableName string, parentID uint, scope []uint64) ([]*Category, error) {
 	var (
 		categoryID uint
 		name       string
@@ -125,6 +245,10 @@ func LisitChirldrenByParentID(db *sql.DB, dBName, tableName string, parentID uin
 		categorys []*Category
 	)
 
+	if err := checkScope(db, dBName, tableName, parentID, scope); err != nil {
+		return nil, err
+	}
+
 	sql := fmt.Sprintf(categorySQLString[mysqlCategoryListChirdByParentID], dBName, tableName)
 
 	rows, err := db.Query(sql, parentID)
@@ -5,7 +5,8 @@ go 1.12
 require (
 	github.com/appleboy/gin-jwt v2.5.0+incompatible
 	github.com/gin-gonic/gin v1.4.0
-	github.com/go-sql-driver/mysql v1.4.1 // indirect
+	github.com/go-sql-driver/mysql v1.4.1
 	golang.org/x/crypto v0.0.0-20190513172903-22d7a77e9e5f
-	gopkg.in/dgrijalva/jwt-go.v3 v3.2.0 // indirect
+	gopkg.in/dgrijalva/jwt-go.v3 v3.2.0
+	gopkg.in/yaml.v2 v2.2.2
 )
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"log"
+	"math"
+	"os"
+
+	admin "github.com/Mictrlan/Miuer/admin/controller/gin"
+	adminModel "github.com/Mictrlan/Miuer/admin/model/mysql"
+	auditModel "github.com/Mictrlan/Miuer/audit/model/mysql"
+	permission "github.com/Mictrlan/Miuer/permission/controller/gin"
+	permissionModel "github.com/Mictrlan/Miuer/permission/model/mysql"
+)
+
+const (
+	bootstrapPwdEnv = "MIUER_BOOTSTRAP_PWD"
+
+	// bootstrapRequestID is the request id of the audit entries recorded by bootstrap
+	bootstrapRequestID = "bootstrap"
+
+	errFmtBootstrapPartial = "[bootstrap]: %v, the database may be partially bootstrapped, rerun bootstrap with the same name to finish it"
+)
+
+var (
+	errBootstrapped    = errors.New("[bootstrap]: admins already exist, the database has been bootstrapped")
+	errBootstrapArgs   = errors.New("[bootstrap]: name, mobile, email and password are required")
+	errRoleNotInserted = errors.New("[bootstrap]: role not found after insert")
+)
+
+// bootstrap create the first admin and a role granted every registered router and the named
+// permissions, UniqueURL is granted too so that permissions are enforced from first boot.
+//
+//	main [-pwd-blocklist file] bootstrap -name root -mobile 13800000000 -email root@example.com
+//
+// The password is read from -pwd or the MIUER_BOOTSTRAP_PWD environment variable. Each step is skipped
+// when it has been done, so a bootstrap that failed halfway is finished by running it again with the
+// same name, the password of an existing admin is kept.
+func bootstrap(dbConn *sql.DB, args []string) {
+	var (
+		fs     = flag.NewFlagSet("bootstrap", flag.ExitOnError)
+		name   = fs.String("name", "", "name of the first admin")
+		pwd    = fs.String("pwd", os.Getenv(bootstrapPwdEnv), "password of the first admin")
+		mobile = fs.String("mobile", "", "mobile of the first admin")
+		email  = fs.String("email", "", "email of the first admin")
+		role   = fs.String("role", "superadmin", "name of the role granted everything")
+	)
+
+	fs.Parse(args)
+
+	if *name == "" || *pwd == "" || *mobile == "" || *email == "" {
+		fs.Usage()
+		log.Fatal(errBootstrapArgs)
+	}
+
+	if err := newAdmin(dbConn).PwdPolicy.Validate(*pwd); err != nil {
+		log.Fatal(err)
+	}
+
+	// registering the routers creates all the tables and collects the routes to grant
+	router := newRouter(dbConn, nil)
+
+	_, total, err := adminModel.ListAdmins(dbConn, "", -1, 0, 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	aid, err := adminModel.GetIDByName(dbConn, *name)
+	switch {
+	case err == sql.ErrNoRows:
+		if total > 0 {
+			log.Fatal(errBootstrapped)
+		}
+	case err != nil:
+		log.Fatal(err)
+	}
+
+	grants := []permissionModel.Permission{
+		{Method: permissionModel.AnyMethod, URL: permission.UniqueURL},
+		{Method: permissionModel.AnyMethod, URL: admin.ManagePermission},
+		{Method: permissionModel.AnyMethod, URL: admin.ImpersonatePermission},
+	}
+
+	for _, route := range router.Routes() {
+		grants = append(grants, permissionModel.Permission{Method: route.Method, URL: route.Path})
+	}
+
+	if err := seed(modelStore{dbConn}, aid, *name, *pwd, *mobile, *email, *role, grants); err != nil {
+		log.Fatalf(errFmtBootstrapPartial, err)
+	}
+
+	log.Printf("[bootstrap]: admin %s is granted role %s", *name, *role)
+}
+
+// seedStore is what seed reads and changes, the models of admin and permission by default
+type seedStore interface {
+	CreateAdmin(name, pwd, mobile, email string) (uint32, error)
+	RoleID(role string) (uint32, error)
+	InsertRole(role string) error
+	RolePermissions(rid uint32) (map[permissionModel.Permission]bool, error)
+	AddPermission(rid uint32, p permissionModel.Permission) error
+	Granted(aid, rid uint32) (bool, error)
+	Grant(aid, rid uint32) error
+}
+
+// seed create the admin unless aid is not 0 and the role unless it exists, grant the permissions
+// the role lacks and grant the role to the admin unless it is granted without bounds
+func seed(store seedStore, aid uint32, name, pwd, mobile, email, role string, grants []permissionModel.Permission) error {
+	var err error
+
+	if aid == 0 {
+		aid, err = store.CreateAdmin(name, pwd, mobile, email)
+		if err != nil {
+			return err
+		}
+	}
+
+	rid, err := store.RoleID(role)
+	if err != nil {
+		return err
+	}
+
+	if rid == 0 {
+		err = store.InsertRole(role)
+		if err != nil {
+			return err
+		}
+
+		rid, err = store.RoleID(role)
+		if err != nil {
+			return err
+		}
+
+		if rid == 0 {
+			return errRoleNotInserted
+		}
+	}
+
+	granted, err := store.RolePermissions(rid)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range grants {
+		if granted[p] {
+			continue
+		}
+
+		if err := store.AddPermission(rid, p); err != nil {
+			return err
+		}
+
+		granted[p] = true
+	}
+
+	// AddRelation affects no row and fails when the grant is unchanged
+	ok, err := store.Granted(aid, rid)
+	if err != nil || ok {
+		return err
+	}
+
+	return store.Grant(aid, rid)
+}
+
+// modelStore is the seedStore of the models, the changes are audited as bootstrap
+type modelStore struct {
+	db *sql.DB
+}
+
+func (m modelStore) CreateAdmin(name, pwd, mobile, email string) (uint32, error) {
+	err := adminModel.Create(m.db, name, pwd, mobile, email)
+	if err != nil {
+		return 0, err
+	}
+
+	return adminModel.GetIDByName(m.db, name)
+}
+
+// RoleID return the id of role, 0 if it doesn't exist
+func (m modelStore) RoleID(role string) (uint32, error) {
+	roles, err := permissionModel.GetRoleList(m.db)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, r := range *roles {
+		if r.Name == role {
+			return r.ID, nil
+		}
+	}
+
+	return 0, nil
+}
+
+func (m modelStore) InsertRole(role string) error {
+	return permissionModel.InsertRole(m.db, role, "granted every permission by bootstrap", bootstrapEntry())
+}
+
+// RolePermissions return the permissions of the role by method and url
+func (m modelStore) RolePermissions(rid uint32) (map[permissionModel.Permission]bool, error) {
+	permissions, err := permissionModel.Permissions(m.db)
+	if err != nil {
+		return nil, err
+	}
+
+	granted := make(map[permissionModel.Permission]bool)
+	for _, p := range *permissions {
+		if p.RoleID == rid {
+			granted[permissionModel.Permission{Method: p.Method, URL: p.URL}] = true
+		}
+	}
+
+	return granted, nil
+}
+
+func (m modelStore) AddPermission(rid uint32, p permissionModel.Permission) error {
+	return permissionModel.AddPermission(m.db, rid, p.Method, p.URL, permissionModel.EffectAllow, bootstrapEntry())
+}
+
+// Granted report whether the role is granted to the admin without bounds, a bounded grant is
+// replaced by Grant
+func (m modelStore) Granted(aid, rid uint32) (bool, error) {
+	grants, _, err := permissionModel.AdminGrants(m.db, aid, 0, math.MaxUint32)
+	if err != nil {
+		return false, err
+	}
+
+	for _, g := range grants {
+		if g.RoleID == rid && g.ValidFrom == "" && g.ValidUntil == "" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (m modelStore) Grant(aid, rid uint32) error {
+	return permissionModel.AddRelation(m.db, aid, rid, nil, nil, bootstrapEntry())
+}
+
+// bootstrapEntry return an audit entry of the system actor for a change made by bootstrap
+func bootstrapEntry() *auditModel.Entry {
+	return &auditModel.Entry{RequestID: bootstrapRequestID}
+}
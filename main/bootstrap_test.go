@@ -0,0 +1,147 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	permissionModel "github.com/Mictrlan/Miuer/permission/model/mysql"
+)
+
+var errUnchanged = errors.New("affected 0 rows")
+
+// fakeStore keeps the seed in memory, a write that changes nothing fails like the models
+type fakeStore struct {
+	admins      map[string]uint32
+	roles       map[string]uint32
+	permissions map[uint32]map[permissionModel.Permission]bool
+	relations   map[[2]uint32]bool
+	writes      int
+	failRole    bool
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		admins:      make(map[string]uint32),
+		roles:       make(map[string]uint32),
+		permissions: make(map[uint32]map[permissionModel.Permission]bool),
+		relations:   make(map[[2]uint32]bool),
+	}
+}
+
+func (f *fakeStore) CreateAdmin(name, pwd, mobile, email string) (uint32, error) {
+	if f.admins[name] != 0 {
+		return 0, errUnchanged
+	}
+
+	f.writes++
+	f.admins[name] = uint32(len(f.admins) + 1)
+	return f.admins[name], nil
+}
+
+func (f *fakeStore) RoleID(role string) (uint32, error) {
+	return f.roles[role], nil
+}
+
+func (f *fakeStore) InsertRole(role string) error {
+	if f.failRole {
+		return errUnchanged
+	}
+
+	f.writes++
+	f.roles[role] = uint32(len(f.roles) + 1)
+	return nil
+}
+
+func (f *fakeStore) RolePermissions(rid uint32) (map[permissionModel.Permission]bool, error) {
+	granted := make(map[permissionModel.Permission]bool)
+	for p := range f.permissions[rid] {
+		granted[p] = true
+	}
+
+	return granted, nil
+}
+
+func (f *fakeStore) AddPermission(rid uint32, p permissionModel.Permission) error {
+	if f.permissions[rid] == nil {
+		f.permissions[rid] = make(map[permissionModel.Permission]bool)
+	}
+
+	if f.permissions[rid][p] {
+		return errUnchanged
+	}
+
+	f.writes++
+	f.permissions[rid][p] = true
+	return nil
+}
+
+func (f *fakeStore) Granted(aid, rid uint32) (bool, error) {
+	return f.relations[[2]uint32{aid, rid}], nil
+}
+
+func (f *fakeStore) Grant(aid, rid uint32) error {
+	if f.relations[[2]uint32{aid, rid}] {
+		return errUnchanged
+	}
+
+	f.writes++
+	f.relations[[2]uint32{aid, rid}] = true
+	return nil
+}
+
+func TestSeedRerun(t *testing.T) {
+	grants := []permissionModel.Permission{
+		{Method: permissionModel.AnyMethod, URL: "/api/v1/permission/addurl"},
+		{Method: "GET", URL: "/api/v1/admin/list"},
+	}
+
+	f := newFakeStore()
+	if err := seed(f, 0, "root", "pwd", "13800000000", "root@example.com", "superadmin", grants); err != nil {
+		t.Fatalf("seed = %v", err)
+	}
+
+	// 1 admin, 1 role, 2 permissions and 1 grant
+	if f.writes != 5 {
+		t.Errorf("seed wrote %d times, want 5", f.writes)
+	}
+
+	f.writes = 0
+	if err := seed(f, f.admins["root"], "root", "pwd", "13800000000", "root@example.com", "superadmin", grants); err != nil {
+		t.Errorf("rerun seed = %v", err)
+	}
+
+	if f.writes != 0 {
+		t.Errorf("rerun seed wrote %d times, want 0", f.writes)
+	}
+
+	// a permission added to the routes since is granted by the rerun
+	grants = append(grants, permissionModel.Permission{Method: "POST", URL: "/api/v1/admin/create"})
+	if err := seed(f, f.admins["root"], "root", "pwd", "13800000000", "root@example.com", "superadmin", grants); err != nil {
+		t.Errorf("rerun seed with a new route = %v", err)
+	}
+
+	if f.writes != 1 || !f.permissions[f.roles["superadmin"]][grants[2]] {
+		t.Errorf("rerun seed wrote %d times, want the new route granted", f.writes)
+	}
+}
+
+func TestSeedPartial(t *testing.T) {
+	grants := []permissionModel.Permission{{Method: "GET", URL: "/api/v1/admin/list"}}
+
+	f := newFakeStore()
+	f.failRole = true
+
+	if err := seed(f, 0, "root", "pwd", "13800000000", "root@example.com", "superadmin", grants); err == nil {
+		t.Fatal("seed succeeded without the role")
+	}
+
+	f.failRole = false
+
+	if err := seed(f, f.admins["root"], "root", "pwd", "13800000000", "root@example.com", "superadmin", grants); err != nil {
+		t.Fatalf("rerun seed = %v", err)
+	}
+
+	if len(f.admins) != 1 || !f.relations[[2]uint32{f.admins["root"], f.roles["superadmin"]}] {
+		t.Errorf("rerun seed left admins %v and grants %v", f.admins, f.relations)
+	}
+}
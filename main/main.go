@@ -1,13 +1,21 @@
 package main
 
 import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	admin "github.com/Mictrlan/Miuer/admin/controller/gin"
+	"github.com/Mictrlan/Miuer/admin/utility"
+	audit "github.com/Mictrlan/Miuer/audit/controller/gin"
 	banner "github.com/Mictrlan/Miuer/banner/controller/gin"
 	category "github.com/Mictrlan/Miuer/category/controller/gin"
 	order "github.com/Mictrlan/Miuer/order/controller/gin"
 	permission "github.com/Mictrlan/Miuer/permission/controller/gin"
+	permissionModel "github.com/Mictrlan/Miuer/permission/model/mysql"
 	smsservice "github.com/Mictrlan/Miuer/smsservice/controller/gin"
 	services "github.com/Mictrlan/Miuer/smsservice/services"
 	upload "github.com/Mictrlan/Miuer/upload/controller/gin"
@@ -19,9 +27,21 @@ import (
 	_ "github.com/go-sql-driver/mysql"
 )
 
+const (
+	logFmtSweep = "[sweepRelations]: %d expired role grants removed"
+
+	errFmtBlocklist = "[main]: can't read password blocklist %s: %v"
+	errFmtKeys      = "[main]: can't load the token signing keys from %s: %v, generate one with " +
+		"`mkdir -p %s && openssl genpkey -algorithm RSA -pkeyopt rsa_keygen_bits:2048 -out %s/$(date +%%Y%%m%%d).pem` " +
+		"or point -keys at the directory of the *.pem keys"
+)
+
 // JWWTmw -
 var (
 	JWTmw *ginjwt.GinJWTMiddleware
+
+	pwdBlocklist = flag.String("pwd-blocklist", "", "file of the common or breached passwords refused, one per line")
+	keysDir      = flag.String("keys", "keys", "directory of the *.pem keys to sign and verify access tokens")
 )
 
 type funcv struct{}
@@ -32,43 +52,36 @@ func (v funcv) OnVerifySucceed(a, b string) {}
 func (v funcv) OnVerifyFailed(a, b string)  {}
 
 func main() {
-	router := gin.Default()
-
 	dbConn, err := sql.Open("mysql", "root:Miufighting.@tcp(127.0.0.1:3306)/Miuer")
 	if err != nil {
 		panic(err)
 	}
 
-	adminCon := admin.New(dbConn)
+	flag.Parse()
 
-	authMiddleware := &ginjwt.GinJWTMiddleware{
-		Realm:            "Template",
-		Key:              []byte("hydra"),
-		Timeout:          24 * time.Hour,
-		TimeFunc:         time.Now,
-		SigningAlgorithm: "HS256",
-		TokenLookup:      "header:Authorization",
+	if args := flag.Args(); len(args) > 0 && args[0] == "bootstrap" {
+		bootstrap(dbConn, args[1:])
+		return
 	}
 
-	GetUID := adminCon.ExtendJWTMiddleWare(authMiddleware)
-	router.POST("/api/v1/admin/login", authMiddleware.LoginHandler)
+	keys, err := utility.LoadKeySet(*keysDir)
+	if err != nil {
+		log.Fatalf(errFmtKeys, *keysDir, err, *keysDir, *keysDir)
+	}
 
-	router.Use(func(ctx *gin.Context) {
-		authMiddleware.MiddlewareFunc()(ctx)
-	})
+	go reloadKeys(keys)
 
-	bannerCon := banner.New(dbConn)
-	bannerCon.Register(router)
+	router := newRouter(dbConn, keys)
 
-	categoryCon := category.New(dbConn, "category", "cate")
-	categoryCon.Register(router)
+	go sweepRelations(dbConn, time.Minute)
 
-	orderCon := order.New(dbConn, "order", "item")
-	orderCon.Register(router)
+	router.Run(":8080")
 
-	permissionCon := permission.New(dbConn)
-	router.Use(permission.CheckPermission(permissionCon, GetUID))
-	permissionCon.Register(router)
+}
+
+// newRouter register all the routers, keys is nil when tokens are not served, e.g. bootstrap
+func newRouter(dbConn *sql.DB, keys *utility.KeySet) *gin.Engine {
+	router := gin.Default()
 
 	sm := &services.Config{
 		Host:           "https://fesms.market.alicloudapi.com/sms/",
@@ -79,6 +92,49 @@ func main() {
 		DB:             dbConn,
 	}
 
+	adminCon := newAdmin(dbConn)
+	adminCon.SMSConf = sm
+	adminCon.Keys = keys
+
+	authMiddleware := &ginjwt.GinJWTMiddleware{
+		Realm:       "Template",
+		Timeout:     15 * time.Minute,
+		TimeFunc:    time.Now,
+		TokenLookup: "header:Authorization",
+	}
+
+	GetUID := adminCon.ExtendJWTMiddleWare(authMiddleware)
+	router.GET("/.well-known/jwks.json", adminCon.JWKS)
+	router.POST("/api/v1/admin/login", adminCon.LoginHandler)
+	router.POST("/api/v1/admin/refresh", adminCon.Refresh)
+	adminCon.RegisterResetRouter(router)
+	adminCon.RegisterInviteRouter(router)
+
+	router.Use(adminCon.Authenticate())
+	router.Use(audit.Track(GetUID, admin.Impersonator))
+
+	adminCon.RegisterSelfRouter(router)
+
+	bannerCon := banner.New(dbConn)
+	bannerCon.Register(router)
+
+	permissionCon := permission.New(dbConn)
+	router.Use(permission.CheckPermission(permissionCon, GetUID))
+	adminCon.RequirePermission = permission.RequirePermission(permissionCon, GetUID)
+	adminCon.TokenClaims = permission.TokenClaims(permissionCon)
+	adminCon.CanImpersonate = permission.CanImpersonate(permissionCon)
+	permissionCon.Register(router)
+
+	auditCon := audit.New(dbConn)
+	auditCon.Register(router)
+
+	// category and order are registered after CheckPermission, which sets their data scopes
+	categoryCon := category.New(dbConn, "category", "cate", permission.DataScope(permissionModel.ScopeCategoryParent))
+	categoryCon.Register(router)
+
+	orderCon := order.New(dbConn, "order", "item", GetUID, permission.DataScope(permissionModel.ScopeOrderUser))
+	orderCon.Register(router)
+
 	smsserviceCon := smsservice.New(dbConn, sm)
 	smsserviceCon.Register(router)
 
@@ -88,6 +144,55 @@ func main() {
 	router.Use(adminCon.CheckIsActive(GetUID))
 	adminCon.RegisterRouter(router)
 
-	router.Run(":8080")
+	permissionCon.SyncCatalog(router.Routes(), admin.ManagePermission, admin.ImpersonatePermission)
+
+	return router
+}
 
+// newAdmin create the admin controller, the password blocklist is loaded from -pwd-blocklist and
+// the process exits if it can't be read
+func newAdmin(dbConn *sql.DB) *admin.AdminController {
+	adminCon := admin.New(dbConn)
+
+	if *pwdBlocklist == "" {
+		return adminCon
+	}
+
+	policy, ok := adminCon.PwdPolicy.(*utility.PasswordPolicy)
+	if !ok {
+		return adminCon
+	}
+
+	if err := policy.LoadBlocklist(*pwdBlocklist); err != nil {
+		log.Fatalf(errFmtBlocklist, *pwdBlocklist, err)
+	}
+
+	return adminCon
+}
+
+// reloadKeys reload the signing keys on SIGHUP to rotate them without restart
+func reloadKeys(keys *utility.KeySet) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
+
+	for range c {
+		if err := keys.Reload(); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// sweepRelations remove the expired role grants periodically, newRouter must have created the tables
+func sweepRelations(dbConn *sql.DB, interval time.Duration) {
+	for range time.Tick(interval) {
+		n, err := permissionModel.SweepExpiredRelations(dbConn)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+
+		if n > 0 {
+			log.Printf(logFmtSweep, n)
+		}
+	}
 }
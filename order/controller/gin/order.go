@@ -10,6 +10,7 @@ import (
 	"strconv"
 	"time"
 
+	audit "github.com/Mictrlan/Miuer/audit/controller/gin"
 	mysql "github.com/Mictrlan/Miuer/order/model/mysql"
 
 	"github.com/gin-gonic/gin"
@@ -23,14 +24,19 @@ type OrderController struct {
 	orderTable     string
 	itemTable      string
 	closedIntercal int
+	getUID         func(ctx *gin.Context) (uint32, error)
+	scope          func(ctx *gin.Context) []uint64
 }
 
-// New create new OrderCOntroller
-func New(db *sql.DB, orderTable, itemTable string) *OrderController {
+// New create new OrderCOntroller, getUID identifies the admin who moves an order and scope return
+// the users whose orders the admin can see, nil means any user
+func New(db *sql.DB, orderTable, itemTable string, getUID func(ctx *gin.Context) (uint32, error), scope func(ctx *gin.Context) []uint64) *OrderController {
 	return &OrderController{
 		db:         db,
 		orderTable: orderTable,
 		itemTable:  itemTable,
+		getUID:     getUID,
+		scope:      scope,
 	}
 }
 
@@ -50,10 +56,17 @@ func (odc *OrderController) Register(r gin.IRouter) {
 		log.Fatal(err)
 	}
 
+	err = mysql.CreateStatusHistoryTable(odc.db, odc.orderTable)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	r.POST("/api/v1/order/create", odc.insert)
 	r.POST("/api/v1/order/info", odc.orderInfoByOrderID)
 	r.POST("/api/v1/order/user", odc.lisitOrderByUserIDAndStatus)
 	r.POST("/api/v1/order/id", odc.orderIDByOrderCode)
+	r.POST("/api/v1/order/status", odc.transit)
+	r.POST("/api/v1/order/history", odc.statusHistory)
 
 }
 
@@ -102,7 +115,7 @@ func (odc *OrderController) insert(ctx *gin.Context) {
 		Created:    times,
 	}
 
-	rep.orderid, err = mysql.Insert(odc.db, order, odc.orderTable, odc.itemTable, req.Items, odc.closedIntercal)
+	rep.orderid, err = mysql.Insert(odc.db, order, odc.orderTable, odc.itemTable, req.Items, odc.closedIntercal, odc.scope(ctx), audit.NewEntry(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
@@ -128,7 +141,7 @@ func (odc *OrderController) orderIDByOrderCode(ctx *gin.Context) {
 		return
 	}
 
-	id, err := mysql.OrderIDByOrderCode(odc.db, odc.orderTable, req.Ordercode)
+	id, err := mysql.OrderIDByOrderCode(odc.db, odc.orderTable, req.Ordercode, odc.scope(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
@@ -153,7 +166,7 @@ func (odc *OrderController) orderInfoByOrderID(ctx *gin.Context) {
 		return
 	}
 
-	rep, err := mysql.OrderInfoByorderID(odc.db, odc.orderTable, odc.itemTable, req.OrderID)
+	rep, err := mysql.OrderInfoByorderID(odc.db, odc.orderTable, odc.itemTable, req.OrderID, odc.scope(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
@@ -167,10 +180,12 @@ func (odc *OrderController) orderInfoByOrderID(ctx *gin.Context) {
 	})
 }
 
+// lisitOrderByUserIDAndStatus lists the orders of a user in a status, the status is a name and is
+// created when missing
 func (odc *OrderController) lisitOrderByUserIDAndStatus(ctx *gin.Context) {
 	var req struct {
-		Userid uint64 `json:"userid"`
-		Status uint8  `json:"status"`
+		Userid uint64       `json:"userid"`
+		Status mysql.Status `json:"status"`
 	}
 
 	err := ctx.ShouldBind(&req)
@@ -180,7 +195,7 @@ func (odc *OrderController) lisitOrderByUserIDAndStatus(ctx *gin.Context) {
 		return
 	}
 
-	orders, err := mysql.ListOrderByUserID(odc.db, odc.orderTable, odc.itemTable, req.Userid, req.Status)
+	orders, err := mysql.ListOrderByUserID(odc.db, odc.orderTable, odc.itemTable, req.Userid, req.Status, odc.scope(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
@@ -192,3 +207,87 @@ func (odc *OrderController) lisitOrderByUserIDAndStatus(ctx *gin.Context) {
 		"orders": orders,
 	})
 }
+
+// transit move an order to the named status, e.g. paid with payway or cancelled with reason
+func (odc *OrderController) transit(ctx *gin.Context) {
+	var req struct {
+		OrderID  uint32 `json:"orderid" binding:"required"`
+		Status   string `json:"status" binding:"required"`
+		Reason   string `json:"reason" binding:"max=512"`
+		PayWay   uint8  `json:"payway"`
+		ShipCode string `json:"shipcode" binding:"max=50"`
+	}
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	to, err := mysql.ParseStatus(req.Status)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	uid, err := odc.getUID(ctx)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	t := &mysql.Transition{
+		To:       to,
+		Reason:   req.Reason,
+		PayWay:   req.PayWay,
+		ShipCode: req.ShipCode,
+	}
+
+	entry := audit.NewEntry(ctx)
+
+	var impersonator uint32
+	if entry != nil {
+		impersonator = entry.ImpersonatorID
+	}
+
+	history, err := mysql.Transit(odc.db, odc.orderTable, req.OrderID, t, uid, impersonator, odc.scope(ctx), entry)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"history": history,
+	})
+}
+
+// statusHistory lists the status changes of an order from the earliest one
+func (odc *OrderController) statusHistory(ctx *gin.Context) {
+	var req struct {
+		OrderID uint32 `json:"orderid" binding:"required"`
+	}
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	history, err := mysql.ListStatusHistory(odc.db, odc.orderTable, req.OrderID, odc.scope(ctx))
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"history": history,
+	})
+}
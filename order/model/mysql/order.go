@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"time"
+
+	audit "github.com/Mictrlan/Miuer/audit/model/mysql"
 )
 
 // Order - order info
@@ -18,7 +20,7 @@ type Order struct {
 	PayWay     uint8     `json:"payway"`
 	Promotion  bool      `json:"promotion"`
 	Freight    uint32    `json:"freight"`
-	Status     uint8     `json:"status"`
+	Status     Status    `json:"status"`
 	Created    time.Time `json:"created"`
 	Closed     time.Time `json:"closed"`
 	Updated    time.Time `json:"updated"`
@@ -48,14 +50,19 @@ const (
 	orderByOrderID
 	itemsByOrderID
 	orderListByUserID
-	payByOrderID
-	consignByOrderID
-	statusByOrderID
+)
+
+// actions and target types of the audit entries recorded by order
+const (
+	auditOrderCreate = "order.create"
+
+	auditTargetOrder = "order"
 )
 
 var (
 	errOrderInsert = errors.New("[insert order] : insert order affected 0 rows")
 	errItemInsert  = errors.New("insert item: insert affected 0 rows")
+	errOrderScope  = errors.New("the order is out of data scope")
 
 	orderSQLString = []string{
 		`CREATE TABLE IF NOT EXISTS Miuer.%s (
@@ -68,7 +75,7 @@ var (
 			payWay          TINYINT UNSIGNED DEFAULT '0',
 			promotion       TINYINT(1) UNSIGNED DEFAULT '0',   
 			freight         INT UNSIGNED NOT NULL,
-			status          TINYINT UNSIGNED DEFAULT '0' COMMENT '0 means the order is not completed',
+			status          TINYINT UNSIGNED DEFAULT '0' COMMENT 'see Status, 0 means the order is created',
 			created         DATETIME DEFAULT NOW(),
 			closed          DATETIME DEFAULT '8012-12-31 00:00:00',
 			updated         DATETIME DEFAULT NOW(),
@@ -89,13 +96,10 @@ var (
 		)ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin COMMENT='orderitem info'`,
 		`INSERT INTO Miuer.%s (orderCode,userID,addressID,totalPrice,promotion,freight,closed) VALUES(?,?,?,?,?,?,?)`,
 		`INSERT INTO Miuer.%s (productID,orderID,count,price,discount) VALUES(?,?,?,?,?)`,
-		`SELECT id FROM Miuer.%s WHERE orderCode = ? LOCK IN SHARE MODE`,
+		`SELECT id,userID FROM Miuer.%s WHERE orderCode = ? LOCK IN SHARE MODE`,
 		`SELECT * FROM Miuer.%s WHERE id = ? LOCK IN SHARE MODE`,
 		`SELECT * FROM Miuer.%s WHERE orderID = ? LOCK IN SHARE MODE`,
 		`SELECT * FROM Miuer.%s WHERE userID = ? AND status = ? LOCK IN SHARE MODE`,
-		`UPDATE Miuer.%s SET payWay = ?, updated = ?, status = 0 WHERE id = ? LIMIT 1 `,
-		`UPDATE Miuer.%s SET shipCode = ?, updated = ?, status = 1 WHERE id = ? LIMIT 1 `,
-		`UPDATE Miuer.%s SET status = ?, updated = ? WHERE id = ? LIMIT 1 `,
 	}
 )
 
@@ -115,77 +119,108 @@ func CreateItemTabke(db *sql.DB, tableName string) error {
 	return err
 }
 
-// Insert - add a order info and all item info
-func Insert(db *sql.DB, order Order, orderTable, itemTable string, items []Item, closedIntercal int) (uint32, error) {
-	tx, err := db.Begin()
-	if err != nil {
-		return 0, err
+// inScope report whether the orders of user can be seen, scope is the users whose orders
+// can be seen and the empty scope means any user
+func inScope(scope []uint64, userID uint64) bool {
+	if len(scope) == 0 {
+		return true
 	}
 
-	defer func() {
-		if err != nil {
-			err = tx.Rollback()
-		} else {
-			err = tx.Commit()
+	for _, id := range scope {
+		if id == userID {
+			return true
 		}
-	}()
-
-	order.Closed = order.Created.Add(time.Duration(closedIntercal * int(time.Hour)))
-
-	sql := fmt.Sprintf(orderSQLString[orderInsert], orderTable)
-
-	result, err := db.Exec(sql, order.OrderCode, order.UserID, order.AddressID, order.TotalPrice, order.Promotion, order.Freight, order.Closed)
-	if err != nil {
-		return 0, err
 	}
 
-	if affected, _ := result.RowsAffected(); affected == 0 {
-		return 0, errOrderInsert
-	}
+	return false
+}
 
-	ID, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
+// Insert - add a order info and all item info, the user of order must be in scope.
+// entry is recorded in the same transaction.
+func Insert(db *sql.DB, order Order, orderTable, itemTable string, items []Item, closedIntercal int, scope []uint64, entry *audit.Entry) (uint32, error) {
+	if !inScope(scope, order.UserID) {
+		return 0, errOrderScope
 	}
 
-	order.ID = uint32(ID)
+	order.Closed = order.Created.Add(time.Duration(closedIntercal * int(time.Hour)))
 
-	for _, x := range items {
-		sql := fmt.Sprintf(orderSQLString[itemInsert], itemTable)
+	err := audit.Transact(db, entry, func(tx *sql.Tx) error {
+		sql := fmt.Sprintf(orderSQLString[orderInsert], orderTable)
 
-		result, err := db.Exec(sql, x.ProductID, order.ID, x.Count, x.Price, x.Discount)
+		result, err := tx.Exec(sql, order.OrderCode, order.UserID, order.AddressID, order.TotalPrice, order.Promotion, order.Freight, order.Closed)
 		if err != nil {
-			return 0, err
+			return err
 		}
 
 		if affected, _ := result.RowsAffected(); affected == 0 {
-			return 0, errItemInsert
+			return errOrderInsert
 		}
+
+		ID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		order.ID = uint32(ID)
+
+		for _, x := range items {
+			sql := fmt.Sprintf(orderSQLString[itemInsert], itemTable)
+
+			result, err := tx.Exec(sql, x.ProductID, order.ID, x.Count, x.Price, x.Discount)
+			if err != nil {
+				return err
+			}
+
+			if affected, _ := result.RowsAffected(); affected == 0 {
+				return errItemInsert
+			}
+		}
+
+		after := &struct {
+			Order
+			Items []Item
+		}{order, items}
+
+		return entry.Describe(auditOrderCreate, auditTargetOrder, order.ID).Change(nil, after)
+	})
+	if err != nil {
+		return 0, err
 	}
 
 	return order.ID, nil
 }
 
-// OrderIDByOrderCode query order id by ordercode
-func OrderIDByOrderCode(db *sql.DB, ostore, ordercode string) (uint32, error) {
-	var orderid uint32
+// OrderIDByOrderCode query order id by ordercode, the user of order must be in scope
+func OrderIDByOrderCode(db *sql.DB, ostore, ordercode string, scope []uint64) (uint32, error) {
+	var (
+		orderid uint32
+		userID  uint64
+	)
 
 	sql := fmt.Sprintf(orderSQLString[orderIDByOrderCode], ostore)
 
-	err := db.QueryRow(sql, ordercode).Scan(&orderid)
+	err := db.QueryRow(sql, ordercode).Scan(&orderid, &userID)
 	if err != nil {
 		return 0, err
 	}
 
+	if !inScope(scope, userID) {
+		return 0, errOrderScope
+	}
+
 	return orderid, nil
 }
 
 // ListOrderByUserID  view orders that have been completed or not completed by the userid and status
 // first get order by userid,next get item by order.ID
-// Return []*ItemOrder when the query is successful
-func ListOrderByUserID(db *sql.DB, ostore, istore string, userid uint64, status uint8) ([]*ItemOrder, error) {
+// Return []*ItemOrder when the query is successful, the user must be in scope
+func ListOrderByUserID(db *sql.DB, ostore, istore string, userid uint64, status Status, scope []uint64) ([]*ItemOrder, error) {
 	var ItOs []*ItemOrder
 
+	if !inScope(scope, userid) {
+		return nil, errOrderScope
+	}
+
 	sql1 := fmt.Sprintf(orderSQLString[orderListByUserID], ostore)
 	sql2 := fmt.Sprintf(orderSQLString[itemsByOrderID], istore)
 
@@ -219,8 +254,8 @@ func ListOrderByUserID(db *sql.DB, ostore, istore string, userid uint64, status
 	return ItOs, nil
 }
 
-// OrderInfoByorderID query ItemOrder by order id
-func OrderInfoByorderID(db *sql.DB, ostore, istore string, orderid uint32) (*ItemOrder, error) {
+// OrderInfoByorderID query ItemOrder by order id, the user of order must be in scope
+func OrderInfoByorderID(db *sql.DB, ostore, istore string, orderid uint32, scope []uint64) (*ItemOrder, error) {
 
 	sql1 := fmt.Sprintf(orderSQLString[orderByOrderID], ostore)
 	sql2 := fmt.Sprintf(orderSQLString[itemsByOrderID], istore)
@@ -230,70 +265,11 @@ func OrderInfoByorderID(db *sql.DB, ostore, istore string, orderid uint32) (*Ite
 		return nil, err
 	}
 
-	return order, nil
-}
-
-// UpdatePayByOrderID modify payway by order id
-func UpdatePayByOrderID(tx *sql.Tx, ostore string, orderid uint32, payway uint8, time time.Time) (uint32, error) {
-	sql := fmt.Sprintf(orderSQLString[payByOrderID], ostore)
-
-	result, err := tx.Exec(sql, payway, time, orderid)
-	if err != nil {
-		return 0, err
-	}
-
-	if affected, _ := result.RowsAffected(); affected == 0 {
-		return 0, errors.New("[change error] ; not update payway infomation for order module ")
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
-
-	return uint32(id), nil
-}
-
-// UpdateShipByOrderID modify shipcode by order id
-func UpdateShipByOrderID(tx *sql.Tx, ostore string, orderid uint32, shipcode string, time time.Time) (uint32, error) {
-	sql := fmt.Sprintf(orderSQLString[consignByOrderID], ostore)
-
-	result, err := tx.Exec(sql, shipcode, time, orderid)
-	if err != nil {
-		return 0, err
-	}
-
-	if affected, _ := result.RowsAffected(); affected == 0 {
-		return 0, errors.New("[change error] : not update ship infomation for order module ")
+	if !inScope(scope, order.UserID) {
+		return nil, errOrderScope
 	}
 
-	id, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
-
-	return uint32(id), nil
-}
-
-// UpdateStatusByOrderID modify status by order id
-func UpdateStatusByOrderID(tx *sql.Tx, ostore string, orderid uint32, status uint8, time time.Time) (uint32, error) {
-	sql := fmt.Sprintf(orderSQLString[statusByOrderID], ostore)
-
-	result, err := tx.Exec(sql, status, time, orderid)
-	if err != nil {
-		return 0, err
-	}
-
-	if affected, _ := result.RowsAffected(); affected == 0 {
-		return 0, errors.New("[change error] : not update status  for order module ")
-	}
-
-	id, err := result.LastInsertId()
-	if err != nil {
-		return 0, err
-	}
-
-	return uint32(id), nil
+	return order, nil
 }
 
 // CheckPromotion -
@@ -328,7 +304,7 @@ func SelectByOrderID(db *sql.DB, query, queryitem string, orderid uint32) (*Item
 	defer rows.Close()
 
 	for rows.Next() {
-		if err := rows.Scan(&od.OrderCode, &od.UserID, &od.ShipCode, &od.AddressID, &od.TotalPrice, &od.PayWay, &od.Promotion, &od.Freight, &od.Status, &od.Created, od.Closed, &od.Updated); err != nil {
+		if err := rows.Scan(&od.ID, &od.OrderCode, &od.UserID, &od.ShipCode, &od.AddressID, &od.TotalPrice, &od.PayWay, &od.Promotion, &od.Freight, &od.Status, &od.Created, &od.Closed, &od.Updated); err != nil {
 			return nil, err
 		}
 	}
@@ -0,0 +1,391 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	audit "github.com/Mictrlan/Miuer/audit/model/mysql"
+)
+
+// Status is the status of an order, it is marshaled by name
+type Status uint8
+
+// the statuses of an order, an order starts as StatusCreated
+const (
+	StatusCreated Status = iota
+	StatusPaid
+	StatusShipped
+	StatusDelivered
+	StatusCompleted
+	StatusCancelled
+	StatusRefunding
+	StatusRefunded
+	StatusClosed
+)
+
+const (
+	historyTable = iota
+	historyInsert
+	historyByOrderID
+	statusLockByOrderID
+	statusUpdateByOrderID
+	statusUserByOrderID
+	historyExists
+	statusRemapLegacy
+)
+
+const (
+	// datetimeLayout is the layout of DATETIME columns, the driver writes time in UTC without loc in dsn
+	datetimeLayout = "2006-01-02 15:04:05"
+
+	auditOrderStatus = "order.status"
+
+	errFmtTransition = "order can't move from %s to %s"
+)
+
+type (
+	// Transition moves an order to To, PayWay is required by StatusPaid, ShipCode by StatusShipped
+	// and Reason by StatusCancelled and StatusRefunding
+	Transition struct {
+		To       Status
+		Reason   string
+		PayWay   uint8
+		ShipCode string
+	}
+
+	// StatusHistory is a status change of an order made by ActorID, ImpersonatorID is the real
+	// admin when ActorID is impersonated, otherwise 0
+	StatusHistory struct {
+		ID             uint64 `json:"id"`
+		OrderID        uint32 `json:"orderid"`
+		From           Status `json:"from"`
+		To             Status `json:"to"`
+		ActorID        uint32 `json:"actorid"`
+		ImpersonatorID uint32 `json:"impersonatorid"`
+		Reason         string `json:"reason"`
+		CreatedAt      string `json:"created"`
+	}
+
+	// statusState is the audited state of a status change
+	statusState struct {
+		Status Status
+		Reason string `json:",omitempty"`
+	}
+
+	// orderState is the part of an order that the transitions read and change
+	orderState struct {
+		UserID   uint64
+		Status   Status
+		PayWay   uint8
+		ShipCode string
+		Closed   time.Time
+	}
+
+	// guard return an error when an order can't make the transition
+	guard func(o *orderState, t *Transition, now time.Time) error
+)
+
+var (
+	errInvalidStatus   = errors.New("unknown order status")
+	errPayWayRequired  = errors.New("payway is required to pay an order")
+	errShipCodeRequire = errors.New("shipcode is required to ship an order")
+	errReasonRequired  = errors.New("reason is required to cancel or refund an order")
+	errOrderNotExpired = errors.New("the order can't be closed before it expires")
+	errStatusChanged   = errors.New("the order status has been changed by another request")
+
+	statusNames = []string{"created", "paid", "shipped", "delivered", "completed", "cancelled", "refunding", "refunded", "closed"}
+
+	// transitions maps a status to the statuses it can move to and their guards, a nil guard always passes.
+	// completed, cancelled and closed are final.
+	transitions = map[Status]map[Status]guard{
+		StatusCreated: {
+			StatusPaid:      requirePayWay,
+			StatusCancelled: requireReason,
+			StatusClosed:    requireExpired,
+		},
+		StatusPaid: {
+			StatusShipped:   requireShipCode,
+			StatusRefunding: requireReason,
+		},
+		StatusShipped: {
+			StatusDelivered: nil,
+		},
+		StatusDelivered: {
+			StatusCompleted: nil,
+			StatusRefunding: requireReason,
+		},
+		StatusRefunding: {
+			StatusRefunded: nil,
+		},
+		StatusRefunded: {
+			StatusClosed: nil,
+		},
+	}
+
+	statusSQLString = []string{
+		`CREATE TABLE IF NOT EXISTS Miuer.%s_status_history (
+			id              BIGINT UNSIGNED NOT NULL AUTO_INCREMENT,
+			orderID         INT UNSIGNED NOT NULL,
+			fromStatus      TINYINT UNSIGNED NOT NULL,
+			toStatus        TINYINT UNSIGNED NOT NULL,
+			actorID         BIGINT UNSIGNED NOT NULL,
+			impersonatorID  BIGINT UNSIGNED NOT NULL DEFAULT 0,
+			reason          VARCHAR(512) NOT NULL DEFAULT '',
+			created         DATETIME NOT NULL,
+			PRIMARY KEY (id),
+			KEY orderID (orderID)
+		)ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin COMMENT='order status history'`,
+		`INSERT INTO Miuer.%s_status_history (orderID,fromStatus,toStatus,actorID,impersonatorID,reason,created) VALUES(?,?,?,?,?,?,?)`,
+		`SELECT id,orderID,fromStatus,toStatus,actorID,impersonatorID,reason,created FROM Miuer.%s_status_history WHERE orderID = ? ORDER BY id LOCK IN SHARE MODE`,
+		`SELECT userID,status,payWay,shipCode,closed FROM Miuer.%s WHERE id = ? FOR UPDATE`,
+		`UPDATE Miuer.%s SET status = ?, payWay = ?, shipCode = ?, updated = ? WHERE id = ? AND status = ? LIMIT 1`,
+		`SELECT userID FROM Miuer.%s WHERE id = ? LOCK IN SHARE MODE`,
+		`SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = 'Miuer' AND TABLE_NAME = '%s_status_history'`,
+		`UPDATE Miuer.%s SET status = CASE WHEN status = 1 THEN ? ELSE ? END WHERE status = 1 OR (status = 0 AND payWay <> 0)`,
+	}
+)
+
+// String return the name of status
+func (s Status) String() string {
+	if int(s) < len(statusNames) {
+		return statusNames[s]
+	}
+
+	return fmt.Sprintf("status(%d)", uint8(s))
+}
+
+// MarshalText marshal status by name
+func (s Status) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalJSON unmarshal status by name
+func (s *Status) UnmarshalJSON(b []byte) error {
+	var name string
+
+	if err := json.Unmarshal(b, &name); err != nil {
+		return errInvalidStatus
+	}
+
+	status, err := ParseStatus(name)
+	if err != nil {
+		return err
+	}
+
+	*s = status
+	return nil
+}
+
+// ParseStatus return the status of name
+func ParseStatus(name string) (Status, error) {
+	for s, n := range statusNames {
+		if n == name {
+			return Status(s), nil
+		}
+	}
+
+	return 0, errInvalidStatus
+}
+
+func requirePayWay(o *orderState, t *Transition, now time.Time) error {
+	if t.PayWay == 0 {
+		return errPayWayRequired
+	}
+
+	return nil
+}
+
+func requireShipCode(o *orderState, t *Transition, now time.Time) error {
+	if t.ShipCode == "" {
+		return errShipCodeRequire
+	}
+
+	return nil
+}
+
+func requireReason(o *orderState, t *Transition, now time.Time) error {
+	if t.Reason == "" {
+		return errReasonRequired
+	}
+
+	return nil
+}
+
+func requireExpired(o *orderState, t *Transition, now time.Time) error {
+	if now.Before(o.Closed) {
+		return errOrderNotExpired
+	}
+
+	return nil
+}
+
+// checkTransition return an error unless the transition table moves o to t.To and the guard passes
+func checkTransition(o *orderState, t *Transition, now time.Time) error {
+	check, exists := transitions[o.Status][t.To]
+	if !exists {
+		return fmt.Errorf(errFmtTransition, o.Status, t.To)
+	}
+
+	if check != nil {
+		return check(o, t, now)
+	}
+
+	return nil
+}
+
+// CreateStatusHistoryTable create the status history table of order table, e.g. order_status_history of order.
+// The orders written before the status history existed are remapped once, the legacy status 1 becomes
+// StatusShipped and the legacy status 0 becomes StatusPaid when the order has a payway, otherwise it
+// stays StatusCreated.
+func CreateStatusHistoryTable(db *sql.DB, ostore string) error {
+	var count int
+
+	err := db.QueryRow(fmt.Sprintf(statusSQLString[historyExists], ostore)).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	// the remap runs before the table is created, no order is moved by the transitions until then.
+	// It is a single statement so that a legacy shipped order isn't mixed up with a remapped paid one.
+	if count == 0 {
+		_, err = db.Exec(fmt.Sprintf(statusSQLString[statusRemapLegacy], ostore), StatusShipped, StatusPaid)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = db.Exec(fmt.Sprintf(statusSQLString[historyTable], ostore))
+	return err
+}
+
+// UpdateStatusByOrderID move the order by t in tx, the transition must be in the transition table and pass
+// its guard. A status history of actor and the admin impersonating actor, if any, is written and returned.
+func UpdateStatusByOrderID(tx *sql.Tx, ostore string, orderid uint32, t *Transition, actor, impersonator uint32, scope []uint64) (*StatusHistory, error) {
+	var (
+		o      orderState
+		closed string
+		now    = time.Now()
+	)
+
+	err := tx.QueryRow(fmt.Sprintf(statusSQLString[statusLockByOrderID], ostore), orderid).Scan(&o.UserID, &o.Status, &o.PayWay, &o.ShipCode, &closed)
+	if err != nil {
+		return nil, err
+	}
+
+	if !inScope(scope, o.UserID) {
+		return nil, errOrderScope
+	}
+
+	o.Closed, err = time.ParseInLocation(datetimeLayout, closed, time.UTC)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkTransition(&o, t, now); err != nil {
+		return nil, err
+	}
+
+	payway, shipcode := o.PayWay, o.ShipCode
+
+	switch t.To {
+	case StatusPaid:
+		payway = t.PayWay
+	case StatusShipped:
+		shipcode = t.ShipCode
+	}
+
+	result, err := tx.Exec(fmt.Sprintf(statusSQLString[statusUpdateByOrderID], ostore), t.To, payway, shipcode, now, orderid, o.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return nil, errStatusChanged
+	}
+
+	h := &StatusHistory{
+		OrderID:        orderid,
+		From:           o.Status,
+		To:             t.To,
+		ActorID:        actor,
+		ImpersonatorID: impersonator,
+		Reason:         t.Reason,
+		CreatedAt:      now.UTC().Format(datetimeLayout),
+	}
+
+	result, err = tx.Exec(fmt.Sprintf(statusSQLString[historyInsert], ostore), h.OrderID, h.From, h.To, h.ActorID, h.ImpersonatorID, h.Reason, now)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	h.ID = uint64(id)
+
+	return h, nil
+}
+
+// Transit move the order by t in a transaction, the user of order must be in scope.
+// entry is recorded in the same transaction.
+func Transit(db *sql.DB, ostore string, orderid uint32, t *Transition, actor, impersonator uint32, scope []uint64, entry *audit.Entry) (*StatusHistory, error) {
+	var h *StatusHistory
+
+	err := audit.Transact(db, entry, func(tx *sql.Tx) error {
+		var err error
+
+		h, err = UpdateStatusByOrderID(tx, ostore, orderid, t, actor, impersonator, scope)
+		if err != nil {
+			return err
+		}
+
+		return entry.Describe(auditOrderStatus, auditTargetOrder, orderid).Change(&statusState{Status: h.From}, &statusState{Status: h.To, Reason: h.Reason})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// ListStatusHistory lists the status changes of the order from the earliest one, the user of order
+// must be in scope
+func ListStatusHistory(db *sql.DB, ostore string, orderid uint32, scope []uint64) ([]*StatusHistory, error) {
+	var (
+		userID uint64
+		result []*StatusHistory
+	)
+
+	err := db.QueryRow(fmt.Sprintf(statusSQLString[statusUserByOrderID], ostore), orderid).Scan(&userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !inScope(scope, userID) {
+		return nil, errOrderScope
+	}
+
+	rows, err := db.Query(fmt.Sprintf(statusSQLString[historyByOrderID], ostore), orderid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var h StatusHistory
+
+		if err := rows.Scan(&h.ID, &h.OrderID, &h.From, &h.To, &h.ActorID, &h.ImpersonatorID, &h.Reason, &h.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		result = append(result, &h)
+	}
+
+	return result, rows.Err()
+}
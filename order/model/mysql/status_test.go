@@ -0,0 +1,140 @@
+package mysql
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCheckTransition(t *testing.T) {
+	var (
+		now     = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+		open    = now.Add(time.Hour)
+		expired = now.Add(-time.Hour)
+	)
+
+	tests := []struct {
+		name string
+		from Status
+		t    Transition
+		open time.Time
+		err  error
+	}{
+		{"pay", StatusCreated, Transition{To: StatusPaid, PayWay: 1}, open, nil},
+		{"pay without payway", StatusCreated, Transition{To: StatusPaid}, open, errPayWayRequired},
+		{"cancel", StatusCreated, Transition{To: StatusCancelled, Reason: "out of stock"}, open, nil},
+		{"cancel without reason", StatusCreated, Transition{To: StatusCancelled}, open, errReasonRequired},
+		{"close expired", StatusCreated, Transition{To: StatusClosed}, expired, nil},
+		{"close at expiry", StatusCreated, Transition{To: StatusClosed}, now, nil},
+		{"close before expiry", StatusCreated, Transition{To: StatusClosed}, open, errOrderNotExpired},
+		{"ship", StatusPaid, Transition{To: StatusShipped, ShipCode: "SF1024"}, open, nil},
+		{"ship without shipcode", StatusPaid, Transition{To: StatusShipped}, open, errShipCodeRequire},
+		{"refund paid", StatusPaid, Transition{To: StatusRefunding, Reason: "changed mind"}, open, nil},
+		{"refund paid without reason", StatusPaid, Transition{To: StatusRefunding}, open, errReasonRequired},
+		{"deliver", StatusShipped, Transition{To: StatusDelivered}, open, nil},
+		{"complete", StatusDelivered, Transition{To: StatusCompleted}, open, nil},
+		{"refund delivered", StatusDelivered, Transition{To: StatusRefunding, Reason: "broken"}, open, nil},
+		{"refunded", StatusRefunding, Transition{To: StatusRefunded}, open, nil},
+		{"close refunded", StatusRefunded, Transition{To: StatusClosed}, open, nil},
+	}
+
+	for _, tt := range tests {
+		o := &orderState{Status: tt.from, Closed: tt.open}
+
+		if err := checkTransition(o, &tt.t, now); err != tt.err {
+			t.Errorf("%s: checkTransition = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestCheckTransitionRefused(t *testing.T) {
+	tests := []struct {
+		name string
+		from Status
+		to   Status
+	}{
+		{"ship unpaid", StatusCreated, StatusShipped},
+		{"pay twice", StatusPaid, StatusPaid},
+		{"cancel paid", StatusPaid, StatusCancelled},
+		{"cancel shipped", StatusShipped, StatusCancelled},
+		{"refund shipped", StatusShipped, StatusRefunding},
+		{"back to created", StatusPaid, StatusCreated},
+		{"skip delivery", StatusShipped, StatusCompleted},
+		{"refund completed", StatusCompleted, StatusRefunding},
+		{"reopen cancelled", StatusCancelled, StatusCreated},
+		{"reopen closed", StatusClosed, StatusPaid},
+		{"close refunding", StatusRefunding, StatusClosed},
+		{"unknown status", Status(42), StatusPaid},
+	}
+
+	// the transition is refused before its guard, the fields every guard needs are filled
+	full := Transition{Reason: "reason", PayWay: 1, ShipCode: "SF1024"}
+	now := time.Now()
+
+	for _, tt := range tests {
+		o := &orderState{Status: tt.from, Closed: now.Add(-time.Hour)}
+		tr := full
+		tr.To = tt.to
+
+		if err := checkTransition(o, &tr, now); err == nil {
+			t.Errorf("%s: %s to %s is allowed", tt.name, tt.from, tt.to)
+		}
+	}
+}
+
+func TestFinalStatuses(t *testing.T) {
+	for _, s := range []Status{StatusCompleted, StatusCancelled, StatusClosed} {
+		if len(transitions[s]) != 0 {
+			t.Errorf("%s is final but moves to %v", s, transitions[s])
+		}
+	}
+}
+
+func TestParseStatus(t *testing.T) {
+	for i, name := range statusNames {
+		s, err := ParseStatus(name)
+		if err != nil || s != Status(i) || s.String() != name {
+			t.Errorf("ParseStatus(%q) = (%v, %v), want %d", name, s, err, i)
+		}
+	}
+
+	for _, name := range []string{"", "Paid", "1", "unknown"} {
+		if _, err := ParseStatus(name); err != errInvalidStatus {
+			t.Errorf("ParseStatus(%q) = %v, want %v", name, err, errInvalidStatus)
+		}
+	}
+
+	if got := Status(42).String(); got != "status(42)" {
+		t.Errorf("String = %s, want status(42)", got)
+	}
+}
+
+func TestStatusJSON(t *testing.T) {
+	tests := []struct {
+		json string
+		want Status
+		ok   bool
+	}{
+		{`"created"`, StatusCreated, true},
+		{`"refunding"`, StatusRefunding, true},
+		{`"unknown"`, 0, false},
+		{`0`, 0, false},
+		{`1`, 0, false},
+		{`-1`, 0, false},
+		{`true`, 0, false},
+	}
+
+	for _, tt := range tests {
+		var s Status
+
+		err := json.Unmarshal([]byte(tt.json), &s)
+		if (err == nil) != tt.ok || (tt.ok && s != tt.want) {
+			t.Errorf("Unmarshal(%s) = (%v, %v), want (%v, ok %v)", tt.json, s, err, tt.want, tt.ok)
+		}
+	}
+
+	b, err := json.Marshal(struct{ Status Status }{StatusShipped})
+	if err != nil || string(b) != `{"Status":"shipped"}` {
+		t.Errorf("Marshal = (%s, %v), want shipped by name", b, err)
+	}
+}
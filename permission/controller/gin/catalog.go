@@ -0,0 +1,102 @@
+package gin
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Mictrlan/Miuer/permission/model/mysql"
+	"github.com/gin-gonic/gin"
+)
+
+const namedPermissionDescription = "named permission"
+
+// SyncCatalog persist the registered routes and the named permissions as the route catalog,
+// it must be called after all the routers are registered.
+func (pc *PermissionController) SyncCatalog(routes gin.RoutesInfo, named ...string) {
+	var catalog []*mysql.Route
+
+	for _, r := range routes {
+		catalog = append(catalog, &mysql.Route{
+			Method:      r.Method,
+			Path:        r.Path,
+			Module:      mysql.RouteModule(r.Path),
+			Description: handlerName(r.Handler),
+		})
+	}
+
+	for _, name := range named {
+		catalog = append(catalog, &mysql.Route{
+			Method:      mysql.AnyMethod,
+			Path:        name,
+			Module:      mysql.RouteModule(name),
+			Description: namedPermissionDescription,
+		})
+	}
+
+	err := mysql.SyncCatalog(pc.db, catalog)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// handlerName trim the package path of a handler, e.g. "gin.(*PermissionController).catalog"
+func handlerName(handler string) string {
+	handler = handler[strings.LastIndex(handler, "/")+1:]
+	return strings.TrimSuffix(handler, "-fm")
+}
+
+func (pc *PermissionController) catalog(ctx *gin.Context) {
+	result, err := mysql.Catalog(pc.db)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status": http.StatusOK,
+		"routes": result,
+	})
+}
+
+func (pc *PermissionController) describeRoute(ctx *gin.Context) {
+	var (
+		route struct {
+			Method      string `json:"method"      binding:"required"`
+			Path        string `json:"path"        binding:"required"`
+			Description string `json:"description" binding:"required,max=512"`
+		}
+	)
+
+	err := ctx.ShouldBind(&route)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = mysql.DescribeRoute(pc.db, strings.ToUpper(route.Method), route.Path, route.Description)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
+
+// unreachableRoutes lists the registered routes that no role is granted
+func (pc *PermissionController) unreachableRoutes(ctx *gin.Context) {
+	result, err := mysql.UnreachableRoutes(pc.db)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status": http.StatusOK,
+		"routes": result,
+	})
+}
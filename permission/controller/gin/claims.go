@@ -0,0 +1,90 @@
+package gin
+
+import (
+	"time"
+
+	"github.com/Mictrlan/Miuer/permission/model/mysql"
+
+	ginjwt "github.com/appleboy/gin-jwt"
+	"github.com/gin-gonic/gin"
+)
+
+// the claims of the roles carried by an access token
+const (
+	claimRoles   = "roles"
+	claimVersion = "perm_version"
+	claimUntil   = "perm_until"
+)
+
+// TokenClaims return the claims of the roles granted to an admin for an access token to carry,
+// CheckPermission trusts them instead of querying the roles while the permission version of the
+// admin is the one in claims. The inherited roles are resolved on each request.
+func TokenClaims(pc *PermissionController) func(aid uint32) (map[string]interface{}, error) {
+	return func(aid uint32) (map[string]interface{}, error) {
+		t, err := mysql.GetTokenRoles(pc.db, aid)
+		if err != nil {
+			return nil, err
+		}
+
+		claims := map[string]interface{}{
+			claimRoles:   t.Roles,
+			claimVersion: t.Version,
+		}
+
+		if t.Until != nil {
+			claims[claimUntil] = t.Until.Unix()
+		}
+
+		return claims, nil
+	}
+}
+
+// adminRoles return the roles of admin and the roles they inherit, the roles in the claims of
+// access token are used while they are current, otherwise the roles are queried
+func (pc *PermissionController) adminRoles(ctx *gin.Context, uid uint32) (map[uint32]bool, error) {
+	if roles, ok := pc.claimedRoles(ctx, uid); ok {
+		return mysql.CachedInheritedRoles(pc.db, roles)
+	}
+
+	return mysql.CachedAssociatedRoleMap(pc.db, uid)
+}
+
+// claimedRoles return the roles in claims, ok is false when the token carries no roles, the grants
+// have changed since the token was issued or a grant has started or ended
+func (pc *PermissionController) claimedRoles(ctx *gin.Context, uid uint32) (map[uint32]bool, bool) {
+	claims := ginjwt.ExtractClaims(ctx)
+
+	list, ok := claims[claimRoles].([]interface{})
+	if !ok {
+		return nil, false
+	}
+
+	version, ok := claims[claimVersion].(float64)
+	if !ok {
+		return nil, false
+	}
+
+	if until, exists := claims[claimUntil]; exists {
+		at, ok := until.(float64)
+		if !ok || !time.Now().Before(time.Unix(int64(at), 0)) {
+			return nil, false
+		}
+	}
+
+	current, err := mysql.CachedPermissionVersion(pc.db, uid)
+	if err != nil || uint64(version) != current {
+		return nil, false
+	}
+
+	roles := make(map[uint32]bool, len(list))
+	for _, v := range list {
+		rid, ok := v.(float64)
+		if !ok {
+			return nil, false
+		}
+
+		roles[uint32(rid)] = true
+	}
+
+	return roles, true
+}
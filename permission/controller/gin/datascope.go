@@ -0,0 +1,114 @@
+package gin
+
+import (
+	"net/http"
+
+	audit "github.com/Mictrlan/Miuer/audit/controller/gin"
+	"github.com/Mictrlan/Miuer/permission/model/mysql"
+	"github.com/gin-gonic/gin"
+)
+
+// DataScopeKey is the context key of the data scope of a request set by CheckPermission,
+// the value is a mysql.DataScope.
+const DataScopeKey = "permission_data_scope"
+
+// DataScopeValues return the values that the records of kind are restricted to in the request,
+// nil means unrestricted, e.g. DataScopeValues(ctx, mysql.ScopeOrderUser) is the users whose
+// orders the admin can see.
+func DataScopeValues(ctx *gin.Context, kind string) []uint64 {
+	v, exists := ctx.Get(DataScopeKey)
+	if !exists {
+		return nil
+	}
+
+	scope, _ := v.(mysql.DataScope)
+
+	return scope[kind]
+}
+
+// DataScope return the resolver of the values that the records of kind are restricted to, it is
+// passed to the controllers that filter records of kind, e.g. DataScope(mysql.ScopeOrderUser).
+func DataScope(kind string) func(ctx *gin.Context) []uint64 {
+	return func(ctx *gin.Context) []uint64 {
+		return DataScopeValues(ctx, kind)
+	}
+}
+
+func (pc *PermissionController) addDataScope(ctx *gin.Context) {
+	var (
+		scope struct {
+			RoleID uint32 `json:"role_id" binding:"required"`
+			Kind   string `json:"kind"    binding:"required"`
+			Value  uint64 `json:"value"   binding:"required"`
+		}
+	)
+
+	err := ctx.ShouldBind(&scope)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = mysql.AddDataScope(pc.db, scope.RoleID, scope.Kind, scope.Value, audit.NewEntry(ctx))
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
+
+func (pc *PermissionController) removeDataScope(ctx *gin.Context) {
+	var (
+		scope struct {
+			RoleID uint32 `json:"role_id" binding:"required"`
+			Kind   string `json:"kind"    binding:"required"`
+			Value  uint64 `json:"value"   binding:"required"`
+		}
+	)
+
+	err := ctx.ShouldBind(&scope)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = mysql.RemoveDataScope(pc.db, scope.RoleID, scope.Kind, scope.Value, audit.NewEntry(ctx))
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
+
+func (pc *PermissionController) dataScopes(ctx *gin.Context) {
+	var (
+		role struct {
+			RoleID uint32 `json:"role_id" binding:"required"`
+		}
+	)
+
+	err := ctx.ShouldBind(&role)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	scopes, err := mysql.DataScopes(pc.db, role.RoleID)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status": http.StatusOK,
+		"scopes": scopes,
+	})
+}
@@ -0,0 +1,72 @@
+package gin
+
+import (
+	"net/http"
+
+	"github.com/Mictrlan/Miuer/permission/model/mysql"
+	"github.com/gin-gonic/gin"
+)
+
+const reasonNotEnforced = "permissions are not enforced until a role is granted addurl and assigned"
+
+// explain evaluate the roles of an admin against a method and path like CheckPermission does,
+// named permissions are explained with an empty method. The roles and rules that produced the
+// decision are returned.
+func (pc *PermissionController) explain(ctx *gin.Context) {
+	var (
+		req struct {
+			AdminID uint32 `json:"admin_id" binding:"required"`
+			Method  string `json:"method"`
+			Path    string `json:"path"     binding:"required"`
+		}
+	)
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	method, err := mysql.PermissionMethod(req.Method)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	roles, err := mysql.CachedAssociatedRoleMap(pc.db, req.AdminID)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	decision, err := mysql.CachedEvaluate(pc.db, roles, method, req.Path)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	enforced, err := pc.enforced()
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	if !enforced {
+		decision.Allowed = true
+		decision.Reason = reasonNotEnforced
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":   http.StatusOK,
+		"allowed":  decision.Allowed,
+		"reason":   decision.Reason,
+		"enforced": enforced,
+		"roles":    decision.Roles,
+		"rules":    decision.Rules,
+	})
+}
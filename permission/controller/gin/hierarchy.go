@@ -0,0 +1,138 @@
+package gin
+
+import (
+	"errors"
+	"net/http"
+
+	audit "github.com/Mictrlan/Miuer/audit/controller/gin"
+	"github.com/Mictrlan/Miuer/permission/model/mysql"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	errRoleOrAdmin = errors.New("exactly one of role_id and admin_id is required")
+)
+
+func (pc *PermissionController) addRoleParent(ctx *gin.Context) {
+	var (
+		parent struct {
+			RoleID   uint32 `json:"role_id"   binding:"required"`
+			ParentID uint32 `json:"parent_id" binding:"required"`
+		}
+	)
+
+	err := ctx.ShouldBind(&parent)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = mysql.AddRoleParent(pc.db, parent.RoleID, parent.ParentID, audit.NewEntry(ctx))
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
+
+func (pc *PermissionController) removeRoleParent(ctx *gin.Context) {
+	var (
+		parent struct {
+			RoleID   uint32 `json:"role_id"   binding:"required"`
+			ParentID uint32 `json:"parent_id" binding:"required"`
+		}
+	)
+
+	err := ctx.ShouldBind(&parent)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = mysql.RemoveRoleParent(pc.db, parent.RoleID, parent.ParentID, audit.NewEntry(ctx))
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
+
+func (pc *PermissionController) roleParents(ctx *gin.Context) {
+	var (
+		role struct {
+			RoleID uint32 `json:"role_id" binding:"required"`
+		}
+	)
+
+	err := ctx.ShouldBind(&role)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	result, err := mysql.RoleParents(pc.db, role.RoleID)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"parents": result,
+	})
+}
+
+// effectivePermissions lists the permissions of a role or an admin, including the inherited ones
+func (pc *PermissionController) effectivePermissions(ctx *gin.Context) {
+	var (
+		target struct {
+			RoleID  uint32 `json:"role_id"`
+			AdminID uint32 `json:"admin_id"`
+		}
+		roles map[uint32]bool
+	)
+
+	err := ctx.ShouldBind(&target)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if (target.RoleID == 0) == (target.AdminID == 0) {
+		ctx.Error(errRoleOrAdmin)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	if target.RoleID != 0 {
+		roles = map[uint32]bool{target.RoleID: true}
+	} else {
+		roles, err = mysql.AssociatedRoleMap(pc.db, target.AdminID)
+		if err != nil {
+			ctx.Error(err)
+			ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+			return
+		}
+	}
+
+	result, err := mysql.EffectivePermissions(pc.db, roles)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":      http.StatusOK,
+		"permissions": result,
+	})
+}
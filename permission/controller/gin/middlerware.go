@@ -8,65 +8,186 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// ScopeKey is the context key of the roles that a request is restricted to, e.g. the scopes of an api key.
+// The value is a map[uint32]bool, the roles of the admin outside the scope are ignored.
+const ScopeKey = "permission_scope"
+
 var (
 	// UniqueURL -
 	UniqueURL = "/api/v1/permission/addurl"
 
-	errPermission = errors.New("Admin permission is wrong")
+	errPermission       = errors.New("Admin permission is wrong")
+	errPermissionDenied = errors.New("Admin permission is denied by a deny rule")
+	errImpersonateRoles = errors.New("the admin has roles that the impersonator doesn't have")
+	errImpersonateDeny  = errors.New("the admin lacks deny rules that the impersonator is held to")
 )
 
 // CheckPermission -
 func CheckPermission(pc *PermissionController, GetUID func(Context *gin.Context) (uint32, error)) func(c *gin.Context) {
 	return func(ctx *gin.Context) {
-
-		var trafficability = false
-		IURL := ctx.Request.URL.Path
-
 		uid, err := GetUID(ctx)
 		if err != nil {
 			ctx.AbortWithError(http.StatusBadRequest, err)
 			return
 		}
 
-		ulrRole, err := mysql.URLPermissions(pc.db, UniqueURL)
+		enforced, err := pc.enforced()
 		if err != nil {
 			ctx.AbortWithError(http.StatusFailedDependency, err)
 			return
 		}
 
-		ulrRoleID, err := mysql.URLPermissions(pc.db, IURL)
-		if err != nil {
-			ctx.AbortWithError(http.StatusForbidden, err)
+		if !enforced {
 			return
 		}
 
-		roleByAdmin, err := mysql.AssociatedRoleMap(pc.db, uid)
+		roleByAdmin, err := pc.adminRoles(ctx, uid)
 		if err != nil {
 			ctx.AbortWithError(http.StatusConflict, err)
 			return
 		}
 
-		allRole, err := mysql.GetAllRoleMap(pc.db)
+		roleByAdmin = scopeRoles(ctx, roleByAdmin)
 
+		// gin 1.4 has no ctx.FullPath, the path is matched against the route patterns of permissions
+		decision, err := mysql.CachedEvaluate(pc.db, roleByAdmin, ctx.Request.Method, ctx.Request.URL.Path)
 		if err != nil {
-			ctx.AbortWithError(http.StatusRequestedRangeNotSatisfiable, err)
+			ctx.AbortWithError(http.StatusForbidden, err)
 			return
 		}
 
-		if len(ulrRole) == 0 || len(allRole) == 0 {
+		if !decision.Allowed {
+			ctx.AbortWithError(http.StatusFailedDependency, decisionError(decision))
 			return
 		}
 
-		for key := range ulrRoleID {
-			if roleByAdmin[key] == true {
+		scope, err := mysql.CachedDataScope(pc.db, roleByAdmin)
+		if err != nil {
+			ctx.AbortWithError(http.StatusFailedDependency, err)
+			return
+		}
+
+		ctx.Set(DataScopeKey, scope)
+	}
+}
+
+// enforced report whether the permissions are checked, they are not until a role is granted
+// UniqueURL and a role is assigned to an admin
+func (pc *PermissionController) enforced() (bool, error) {
+	ulrRole, err := mysql.CachedURLPermissions(pc.db, UniqueURL)
+	if err != nil {
+		return false, err
+	}
+
+	allRole, err := mysql.CachedAllRoleMap(pc.db)
+	if err != nil {
+		return false, err
+	}
+
+	return len(ulrRole) != 0 && len(allRole) != 0, nil
+}
+
+func decisionError(decision *mysql.Decision) error {
+	if decision.Reason == mysql.ReasonDenied {
+		return errPermissionDenied
+	}
+
+	return errPermission
+}
+
+// RequirePermission return a middleware factory, the middleware only lets the admins that
+// have an active role granted the named permission through.
+// Named permissions are stored like urls, e.g. "admin:manage".
+func RequirePermission(pc *PermissionController, GetUID func(Context *gin.Context) (uint32, error)) func(name string) gin.HandlerFunc {
+	return func(name string) gin.HandlerFunc {
+		return func(ctx *gin.Context) {
+			uid, err := GetUID(ctx)
+			if err != nil {
+				ctx.AbortWithError(http.StatusBadRequest, err)
+				return
+			}
+
+			enforced, err := pc.enforced()
+			if err != nil {
+				ctx.AbortWithError(http.StatusFailedDependency, err)
+				return
+			}
+
+			// the system has not been locked down yet
+			if !enforced {
 				return
 			}
+
+			roleByAdmin, err := pc.adminRoles(ctx, uid)
+			if err != nil {
+				ctx.AbortWithError(http.StatusConflict, err)
+				return
+			}
+
+			roleByAdmin = scopeRoles(ctx, roleByAdmin)
+
+			decision, err := mysql.CachedEvaluate(pc.db, roleByAdmin, mysql.AnyMethod, name)
+			if err != nil {
+				ctx.AbortWithError(http.StatusForbidden, err)
+				return
+			}
+
+			if !decision.Allowed {
+				ctx.AbortWithError(http.StatusForbidden, decisionError(decision))
+			}
+		}
+	}
+}
+
+// CanImpersonate return a check that refuses an impersonation unless every role of target, including
+// the inherited ones, is a role of actor and target holds every deny rule of actor, so that no admin
+// gains access by impersonating another one.
+func CanImpersonate(pc *PermissionController) func(actor, target uint32) error {
+	return func(actor, target uint32) error {
+		actorRoles, err := mysql.CachedAssociatedRoleMap(pc.db, actor)
+		if err != nil {
+			return err
+		}
+
+		targetRoles, err := mysql.CachedAssociatedRoleMap(pc.db, target)
+		if err != nil {
+			return err
+		}
+
+		for rid := range targetRoles {
+			if !actorRoles[rid] {
+				return errImpersonateRoles
+			}
+		}
+
+		lifted, err := mysql.CachedLiftedDenies(pc.db, actorRoles, targetRoles)
+		if err != nil {
+			return err
 		}
 
-		if !trafficability {
-			ctx.AbortWithError(http.StatusFailedDependency, nil)
+		if len(lifted) > 0 {
+			return errImpersonateDeny
 		}
 
+		return nil
+	}
+}
+
+// scopeRoles keep the roles inside the scope of request
+func scopeRoles(ctx *gin.Context, roles map[uint32]bool) map[uint32]bool {
+	v, exists := ctx.Get(ScopeKey)
+	if !exists {
+		return roles
+	}
+
+	result := make(map[uint32]bool)
+	scope, _ := v.(map[uint32]bool)
+
+	for key := range roles {
+		if scope[key] {
+			result[key] = true
+		}
 	}
 
+	return result
 }
@@ -1,16 +1,39 @@
 package gin
 
 import (
+	"errors"
 	"net/http"
+	"strings"
 
+	audit "github.com/Mictrlan/Miuer/audit/controller/gin"
 	"github.com/Mictrlan/Miuer/permission/model/mysql"
 	"github.com/gin-gonic/gin"
 )
 
+var (
+	errInvalidEffect = errors.New("effect must be allow or deny")
+)
+
+// permissionEffect normalize the effect of a permission, empty means allow
+func permissionEffect(effect string) (string, error) {
+	switch strings.ToLower(effect) {
+	case "", mysql.EffectAllow:
+		return mysql.EffectAllow, nil
+	case mysql.EffectDeny:
+		return mysql.EffectDeny, nil
+	}
+
+	return "", errInvalidEffect
+}
+
+// addURLPermission grant or deny a role the method and gin style url pattern, e.g. GET /api/v1/order/:id,
+// the pattern must cover a route of catalog, a deny rule overrides the allow rules of all the roles of an admin
 func (pc *PermissionController) addURLPermission(ctx *gin.Context) {
 	var (
 		url struct {
 			URL    string `json:"url"     binding:"required"`
+			Method string `json:"method"`
+			Effect string `json:"effect"`
 			RoleID uint32 `json:"role_id" binding:"required"`
 		}
 	)
@@ -22,7 +45,28 @@ func (pc *PermissionController) addURLPermission(ctx *gin.Context) {
 		return
 	}
 
-	err = mysql.AddURLPermission(pc.db, url.RoleID, url.URL)
+	method, err := mysql.PermissionMethod(url.Method)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	effect, err := permissionEffect(url.Effect)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = mysql.CheckKnownRoute(pc.db, method, url.URL)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = mysql.AddPermission(pc.db, url.RoleID, method, url.URL, effect, audit.NewEntry(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusBadGateway, gin.H{"status": http.StatusBadGateway})
@@ -36,6 +80,7 @@ func (pc *PermissionController) removeURLPermission(ctx *gin.Context) {
 	var (
 		url struct {
 			URL    string `json:"url"  binding:"required"`
+			Method string `json:"method"`
 			RoleID uint32 `json:"role_id"   binding:"required"`
 		}
 	)
@@ -47,7 +92,14 @@ func (pc *PermissionController) removeURLPermission(ctx *gin.Context) {
 		return
 	}
 
-	err = mysql.RemoveURLPermission(pc.db, url.RoleID, url.URL)
+	method, err := mysql.PermissionMethod(url.Method)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = mysql.RemovePermission(pc.db, url.RoleID, method, url.URL, audit.NewEntry(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusBadGateway, gin.H{"status": http.StatusBadGateway})
@@ -0,0 +1,84 @@
+package gin
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	audit "github.com/Mictrlan/Miuer/audit/controller/gin"
+	"github.com/Mictrlan/Miuer/permission/model/mysql"
+	"github.com/gin-gonic/gin"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// maxPolicySize is the max size of policy document in bytes
+const maxPolicySize = 4 << 20
+
+// exportPolicy respond the whole access policy as a yaml document
+func (pc *PermissionController) exportPolicy(ctx *gin.Context) {
+	policy, err := mysql.ExportPolicy(pc.db)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.YAML(http.StatusOK, policy)
+}
+
+// importPolicy apply the yaml policy document of request body, the unknown fields are refused.
+// With query dry_run=true, the changes are returned without being applied. The permissions refused by
+// the method whitelist or the route catalog are returned in errors and fail the import.
+func (pc *PermissionController) importPolicy(ctx *gin.Context) {
+	var (
+		query struct {
+			DryRun bool `form:"dry_run"`
+		}
+		policy mysql.Policy
+	)
+
+	err := ctx.ShouldBindQuery(&query)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(ctx.Request.Body, maxPolicySize))
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = yaml.UnmarshalStrict(body, &policy)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	changes, err := mysql.ImportPolicy(pc.db, &policy, query.DryRun, audit.NewEntry(ctx))
+	if refused, ok := err.(mysql.PolicyErrors); ok {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{
+			"status":  http.StatusPreconditionFailed,
+			"dry_run": query.DryRun,
+			"changes": changes,
+			"errors":  refused,
+		})
+		return
+	}
+
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status":  http.StatusOK,
+		"dry_run": query.DryRun,
+		"changes": changes,
+	})
+}
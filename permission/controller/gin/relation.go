@@ -2,17 +2,41 @@ package gin
 
 import (
 	"net/http"
+	"time"
 
+	audit "github.com/Mictrlan/Miuer/audit/controller/gin"
 	"github.com/Mictrlan/Miuer/permission/model/mysql"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	defaultPageSize = 20
+)
+
+// parseValidity parse an optional RFC 3339 time of a grant, empty means unbounded
+func parseValidity(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// addRelation grant a role to admin, valid_from and valid_until are optional RFC 3339 times
+// that bound the grant, e.g. for contractors and on-call escalation
 func (pc *PermissionController) addRelation(ctx *gin.Context) {
 	var (
 		relation struct {
-			AdminID uint32 `json:"admin_id" binding:"required"`
-			RoleID  uint32 `json:"role_id" binding:"required"`
+			AdminID    uint32 `json:"admin_id" binding:"required"`
+			RoleID     uint32 `json:"role_id" binding:"required"`
+			ValidFrom  string `json:"valid_from"`
+			ValidUntil string `json:"valid_until"`
 		}
 	)
 
@@ -23,7 +47,21 @@ func (pc *PermissionController) addRelation(ctx *gin.Context) {
 		return
 	}
 
-	err = mysql.AddRelation(pc.db, relation.AdminID, relation.RoleID)
+	validFrom, err := parseValidity(relation.ValidFrom)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	validUntil, err := parseValidity(relation.ValidUntil)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = mysql.AddRelation(pc.db, relation.AdminID, relation.RoleID, validFrom, validUntil, audit.NewEntry(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
@@ -33,6 +71,19 @@ func (pc *PermissionController) addRelation(ctx *gin.Context) {
 	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
 }
 
+// pagination fill the default page and size, page starts from 1
+func pagination(page, size uint32) (uint32, uint32) {
+	if page == 0 {
+		page = 1
+	}
+
+	if size == 0 {
+		size = defaultPageSize
+	}
+
+	return page, size
+}
+
 func (pc *PermissionController) removeRelation(ctx *gin.Context) {
 	var (
 		relation struct {
@@ -48,7 +99,7 @@ func (pc *PermissionController) removeRelation(ctx *gin.Context) {
 		return
 	}
 
-	err = mysql.RemoveRelation(pc.db, relation.AdminID, relation.RoleID)
+	err = mysql.RemoveRelation(pc.db, relation.AdminID, relation.RoleID, audit.NewEntry(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
@@ -57,3 +108,73 @@ func (pc *PermissionController) removeRelation(ctx *gin.Context) {
 
 	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
 }
+
+// roleGrants lists the admins holding a role by page
+func (pc *PermissionController) roleGrants(ctx *gin.Context) {
+	var (
+		req struct {
+			RoleID uint32 `json:"role_id" binding:"required"`
+			Page   uint32 `json:"page"`
+			Size   uint32 `json:"size"    binding:"max=100"`
+		}
+	)
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	page, size := pagination(req.Page, req.Size)
+
+	grants, total, err := mysql.RoleGrants(pc.db, req.RoleID, (page-1)*size, size)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status": http.StatusOK,
+		"grants": grants,
+		"total":  total,
+		"page":   page,
+		"size":   size,
+	})
+}
+
+// adminGrants lists the roles of an admin by page
+func (pc *PermissionController) adminGrants(ctx *gin.Context) {
+	var (
+		req struct {
+			AdminID uint32 `json:"admin_id" binding:"required"`
+			Page    uint32 `json:"page"`
+			Size    uint32 `json:"size"     binding:"max=100"`
+		}
+	)
+
+	err := ctx.ShouldBind(&req)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	page, size := pagination(req.Page, req.Size)
+
+	grants, total, err := mysql.AdminGrants(pc.db, req.AdminID, (page-1)*size, size)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{
+		"status": http.StatusOK,
+		"grants": grants,
+		"total":  total,
+		"page":   page,
+		"size":   size,
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 
+	audit "github.com/Mictrlan/Miuer/audit/controller/gin"
 	"github.com/Mictrlan/Miuer/permission/model/mysql"
 
 	"github.com/gin-gonic/gin"
@@ -43,9 +44,30 @@ func (pc *PermissionController) Register(r gin.IRouter) {
 		log.Fatal(err)
 	}
 
+	err = mysql.CreateVersionTable(pc.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = mysql.CreateRoleParentTable(pc.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = mysql.CreateCatalogTable(pc.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = mysql.CreateDataScopeTable(pc.db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	r.POST("/api/v1/permission/addrole", pc.createRole)
 	r.POST("/api/v1/permission/modifyrole", pc.modifyRoleByID)
 	r.POST("/api/v1/permission/activerole", pc.modifyRoleActiveByID)
+	r.POST("/api/v1/permission/deleterole", pc.deleteRole)
 	r.POST("/api/v1/permission/getrole", pc.getRoleList)
 	r.POST("/api/v1/permission/getidrole", pc.getRoleByID)
 
@@ -53,9 +75,28 @@ func (pc *PermissionController) Register(r gin.IRouter) {
 	r.POST("/api/v1/permission/removeurl", pc.removeURLPermission)
 	r.POST("/api/v1/permission/urlgetrole", pc.URLPermissions)
 	r.POST("/api/v1/permission/getpermission", pc.permissions)
+	r.POST("/api/v1/permission/effective", pc.effectivePermissions)
+	r.POST("/api/v1/permission/explain", pc.explain)
+
+	r.POST("/api/v1/permission/adddatascope", pc.addDataScope)
+	r.POST("/api/v1/permission/removedatascope", pc.removeDataScope)
+	r.POST("/api/v1/permission/getdatascope", pc.dataScopes)
+
+	r.POST("/api/v1/permission/addparent", pc.addRoleParent)
+	r.POST("/api/v1/permission/removeparent", pc.removeRoleParent)
+	r.POST("/api/v1/permission/getparent", pc.roleParents)
+
+	r.POST("/api/v1/permission/catalog", pc.catalog)
+	r.POST("/api/v1/permission/catalog/describe", pc.describeRoute)
+	r.POST("/api/v1/permission/catalog/unreachable", pc.unreachableRoutes)
+
+	r.POST("/api/v1/permission/policy/export", pc.exportPolicy)
+	r.POST("/api/v1/permission/policy/import", pc.importPolicy)
 
 	r.POST("/api/v1/permission/addrelation", pc.addRelation)
 	r.POST("/api/v1/permission/removerelation", pc.removeRelation)
+	r.POST("/api/v1/permission/roleadmins", pc.roleGrants)
+	r.POST("/api/v1/permission/adminroles", pc.adminGrants)
 
 }
 
@@ -75,7 +116,7 @@ func (pc *PermissionController) createRole(ctx *gin.Context) {
 		return
 	}
 
-	err = mysql.InsertRole(pc.db, role.Name, role.Intro)
+	err = mysql.InsertRole(pc.db, role.Name, role.Intro, audit.NewEntry(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
@@ -102,7 +143,7 @@ func (pc *PermissionController) modifyRoleByID(ctx *gin.Context) {
 		return
 	}
 
-	err = mysql.ModifyRoleByID(pc.db, role.ID, role.Name, role.Intro)
+	err = mysql.ModifyRoleByID(pc.db, role.ID, role.Name, role.Intro, audit.NewEntry(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
@@ -127,7 +168,34 @@ func (pc *PermissionController) modifyRoleActiveByID(ctx *gin.Context) {
 		return
 	}
 
-	err = mysql.ModifyRoleActiveByID(pc.db, role.ID, role.Active)
+	err = mysql.ModifyRoleActiveByID(pc.db, role.ID, role.Active, audit.NewEntry(ctx))
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"status": http.StatusOK})
+}
+
+// deleteRole delete a role, a role in use is refused unless cascade, which deletes its
+// permissions, inheritance and grants too
+func (pc *PermissionController) deleteRole(ctx *gin.Context) {
+	var (
+		role struct {
+			ID      uint32 `json:"id"      binding:"required"`
+			Cascade bool   `json:"cascade"`
+		}
+	)
+
+	err := ctx.ShouldBind(&role)
+	if err != nil {
+		ctx.Error(err)
+		ctx.JSON(http.StatusBadRequest, gin.H{"status": http.StatusBadRequest})
+		return
+	}
+
+	err = mysql.DeleteRole(pc.db, role.ID, role.Cascade, audit.NewEntry(ctx))
 	if err != nil {
 		ctx.Error(err)
 		ctx.JSON(http.StatusPreconditionFailed, gin.H{"status": http.StatusPreconditionFailed})
@@ -0,0 +1,93 @@
+package mysql
+
+import (
+	"database/sql"
+
+	audit "github.com/Mictrlan/Miuer/audit/model/mysql"
+)
+
+// actions and target types of the audit entries recorded by permission
+const (
+	auditRoleCreate       = "role.create"
+	auditRoleModify       = "role.modify"
+	auditRoleActive       = "role.active"
+	auditRoleDelete       = "role.delete"
+	auditPermissionAdd    = "permission.add"
+	auditPermissionRemove = "permission.remove"
+	auditRelationAdd      = "relation.add"
+	auditRelationRemove   = "relation.remove"
+	auditRelationExpire   = "relation.expire"
+	auditParentAdd        = "role_parent.add"
+	auditParentRemove     = "role_parent.remove"
+	auditDataScopeAdd     = "data_scope.add"
+	auditDataScopeRemove  = "data_scope.remove"
+	auditPolicyImport     = "policy.import"
+
+	auditTargetRole   = "role"
+	auditTargetAdmin  = "admin"
+	auditTargetPolicy = "policy"
+)
+
+// roleParent is the audited state of role inheritance
+type roleParent struct {
+	RoleID   uint32
+	ParentID uint32
+}
+
+// recordRemovedGrants record an entry of action for each grant selected by query in tx, it must run
+// before the grants are deleted. The entries are made by the actor of request, or by the system when
+// request is nil, and the state of request itself is untouched.
+func recordRemovedGrants(tx *sql.Tx, request *audit.Entry, action, query string, args ...interface{}) error {
+	var removed []*relationState
+
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var (
+			r                     relationState
+			validFrom, validUntil sql.NullString
+		)
+
+		if err := rows.Scan(&r.AdminID, &r.RoleID, &validFrom, &validUntil); err != nil {
+			rows.Close()
+			return err
+		}
+
+		if r.ValidFrom, err = parseDatetime(validFrom); err != nil {
+			rows.Close()
+			return err
+		}
+
+		if r.ValidUntil, err = parseDatetime(validUntil); err != nil {
+			rows.Close()
+			return err
+		}
+
+		removed = append(removed, &r)
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range removed {
+		entry := &audit.Entry{}
+		if request != nil {
+			*entry = *request
+		}
+
+		if err := entry.Describe(action, auditTargetAdmin, r.AdminID).Change(r, nil); err != nil {
+			return err
+		}
+
+		if err := audit.Record(tx, entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
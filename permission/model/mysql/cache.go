@@ -0,0 +1,186 @@
+package mysql
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// CacheTTL is how long the cached permissions, admin roles and permission versions are trusted. Changes made through
+// this package invalidate the cache at once, the ttl bounds the staleness of changes made by
+// other instances or other packages. A ttl <= 0 disables the cache.
+var CacheTTL = 30 * time.Second
+
+// snapshot is the allow and deny rules and data scope rules of active roles, the active role graph
+// and the assigned roles
+type snapshot struct {
+	permissions []*Permission
+	scopes      []*DataScopeRule
+	graph       roleGraph
+	assigned    map[uint32]bool
+	loadedAt    time.Time
+}
+
+type adminRoles struct {
+	roles    map[uint32]bool
+	loadedAt time.Time
+}
+
+type adminVersion struct {
+	version  uint64
+	loadedAt time.Time
+}
+
+// cache is shared by all the callers, the maps it returns must not be modified.
+// generation is increased on invalidation so that a load racing with it is not stored.
+var cache = struct {
+	sync.RWMutex
+	generation uint64
+	snapshot   *snapshot
+	admins     map[uint32]*adminRoles
+	versions   map[uint32]*adminVersion
+}{
+	admins:   make(map[uint32]*adminRoles),
+	versions: make(map[uint32]*adminVersion),
+}
+
+// InvalidateCache drop all the cached permissions, admin roles and permission versions
+func InvalidateCache() {
+	cache.Lock()
+	cache.generation++
+	cache.snapshot = nil
+	cache.admins = make(map[uint32]*adminRoles)
+	cache.versions = make(map[uint32]*adminVersion)
+	cache.Unlock()
+}
+
+func fresh(loadedAt time.Time) bool {
+	return time.Since(loadedAt) < CacheTTL
+}
+
+func cachedSnapshot(db *sql.DB) (*snapshot, error) {
+	cache.RLock()
+	s, generation := cache.snapshot, cache.generation
+	cache.RUnlock()
+
+	if s != nil && fresh(s.loadedAt) {
+		return s, nil
+	}
+
+	var err error
+
+	s = &snapshot{loadedAt: time.Now()}
+
+	if s.permissions, err = activePermissions(db); err != nil {
+		return nil, err
+	}
+
+	if s.scopes, err = activeDataScopes(db); err != nil {
+		return nil, err
+	}
+
+	if s.graph, err = activeRoleGraph(db); err != nil {
+		return nil, err
+	}
+
+	if s.assigned, err = GetAllRoleMap(db); err != nil {
+		return nil, err
+	}
+
+	cache.Lock()
+	if CacheTTL > 0 && cache.generation == generation {
+		cache.snapshot = s
+	}
+	cache.Unlock()
+
+	return s, nil
+}
+
+// CachedURLPermissions is URLPermissions served from cache
+func CachedURLPermissions(db *sql.DB, url string) (map[uint32]bool, error) {
+	s, err := cachedSnapshot(db)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[uint32]bool)
+	for _, p := range s.permissions {
+		if p.Effect == EffectAllow && p.URL == url {
+			result[p.RoleID] = true
+		}
+	}
+
+	return s.graph.descendants(result), nil
+}
+
+// CachedAllRoleMap is GetAllRoleMap served from cache
+func CachedAllRoleMap(db *sql.DB) (map[uint32]bool, error) {
+	s, err := cachedSnapshot(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.assigned, nil
+}
+
+// CachedAssociatedRoleMap is AssociatedRoleMap served from cache, errors are not cached
+func CachedAssociatedRoleMap(db *sql.DB, aid uint32) (map[uint32]bool, error) {
+	cache.RLock()
+	a, generation := cache.admins[aid], cache.generation
+	cache.RUnlock()
+
+	if a != nil && fresh(a.loadedAt) {
+		return a.roles, nil
+	}
+
+	loadedAt := time.Now()
+
+	roles, err := AssociatedRoleMap(db, aid)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.Lock()
+	if CacheTTL > 0 && cache.generation == generation {
+		cache.admins[aid] = &adminRoles{roles: roles, loadedAt: loadedAt}
+	}
+	cache.Unlock()
+
+	return roles, nil
+}
+
+// CachedPermissionVersion is PermissionVersion served from cache, errors are not cached
+func CachedPermissionVersion(db *sql.DB, aid uint32) (uint64, error) {
+	cache.RLock()
+	v, generation := cache.versions[aid], cache.generation
+	cache.RUnlock()
+
+	if v != nil && fresh(v.loadedAt) {
+		return v.version, nil
+	}
+
+	loadedAt := time.Now()
+
+	version, err := PermissionVersion(db, aid)
+	if err != nil {
+		return 0, err
+	}
+
+	cache.Lock()
+	if CacheTTL > 0 && cache.generation == generation {
+		cache.versions[aid] = &adminVersion{version: version, loadedAt: loadedAt}
+	}
+	cache.Unlock()
+
+	return version, nil
+}
+
+// CachedInheritedRoles is InheritedRoles served from cache
+func CachedInheritedRoles(db *sql.DB, roles map[uint32]bool) (map[uint32]bool, error) {
+	s, err := cachedSnapshot(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.graph.ancestors(roles), nil
+}
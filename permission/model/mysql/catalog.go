@@ -0,0 +1,202 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+const (
+	mysqlCatalogCreateTable = iota
+	mysqlCatalogUnregisterAll
+	mysqlCatalogUpsert
+	mysqlCatalogList
+	mysqlCatalogDescribe
+)
+
+// Route is an entry of the route catalog, named permissions are stored with AnyMethod.
+// Registered is false when the route is no longer served.
+type Route struct {
+	Method      string
+	Path        string
+	Module      string
+	Description string
+	Registered  bool
+	CreatedAt   string
+}
+
+var (
+	errUnknownRoute = errors.New("the url doesn't match any registered route")
+
+	catalogSQLString = []string{
+		`CREATE TABLE IF NOT EXISTS admin.route_catalog (
+			method          VARCHAR(16) NOT NULL,
+			path            VARCHAR(512) NOT NULL,
+			module          VARCHAR(64) NOT NULL DEFAULT ' ',
+			description     VARCHAR(512) NOT NULL DEFAULT ' ',
+			registered      BOOLEAN DEFAULT TRUE,
+			created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (method,path)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;`,
+		`UPDATE admin.route_catalog SET registered = false`,
+		`INSERT INTO admin.route_catalog(method,path,module,description,registered) VALUES (?,?,?,?,true) ON DUPLICATE KEY UPDATE module = VALUES(module), registered = true`,
+		`SELECT method,path,module,description,registered,created_at FROM admin.route_catalog ORDER BY module,path,method LOCK IN SHARE MODE`,
+		`UPDATE admin.route_catalog SET description = ? WHERE method = ? AND path = ? LIMIT 1`,
+	}
+)
+
+// CreateCatalogTable create route catalog table.
+func CreateCatalogTable(db *sql.DB) error {
+	_, err := db.Exec(catalogSQLString[mysqlCatalogCreateTable])
+	return err
+}
+
+// RouteModule return the module of a route, e.g. "order" of "/api/v1/order/create"
+// and "admin" of "admin:manage".
+func RouteModule(path string) string {
+	if !strings.HasPrefix(path, "/") {
+		return strings.SplitN(path, ":", 2)[0]
+	}
+
+	segments := strings.Split(path, "/")
+	if len(segments) > 3 && segments[1] == "api" {
+		return segments[3]
+	}
+
+	if len(segments) > 1 {
+		return segments[1]
+	}
+
+	return ""
+}
+
+// SyncCatalog mark the routes as the registered ones, the description of a known route is kept.
+func SyncCatalog(db *sql.DB, routes []*Route) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	_, err = tx.Exec(catalogSQLString[mysqlCatalogUnregisterAll])
+	if err != nil {
+		return err
+	}
+
+	for _, r := range routes {
+		_, err = tx.Exec(catalogSQLString[mysqlCatalogUpsert], r.Method, r.Path, r.Module, r.Description)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+// Catalog lists all the routes of catalog.
+func Catalog(db *sql.DB) ([]*Route, error) {
+	return catalog(db)
+}
+
+func catalog(q querier) ([]*Route, error) {
+	var result []*Route
+
+	rows, err := q.Query(catalogSQLString[mysqlCatalogList])
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var r Route
+
+		if err := rows.Scan(&r.Method, &r.Path, &r.Module, &r.Description, &r.Registered, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		result = append(result, &r)
+	}
+
+	return result, rows.Err()
+}
+
+// DescribeRoute modify the description of a route.
+func DescribeRoute(db *sql.DB, method, path, description string) error {
+	result, err := db.Exec(catalogSQLString[mysqlCatalogDescribe], description, method, path)
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return errInvalidMysql
+	}
+
+	return nil
+}
+
+// CheckKnownRoute return an error unless the method and URL pattern of a permission cover
+// at least one registered route of catalog.
+func CheckKnownRoute(db *sql.DB, method, url string) error {
+	routes, err := Catalog(db)
+	if err != nil {
+		return err
+	}
+
+	if !knownRoute(routes, method, url) {
+		return errUnknownRoute
+	}
+
+	return nil
+}
+
+func knownRoute(routes []*Route, method, url string) bool {
+	for _, r := range routes {
+		if r.Registered && MatchMethod(method, r.Method) && MatchPattern(url, r.Path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UnreachableRoutes lists the registered routes that no allow rule of an active role matches.
+func UnreachableRoutes(db *sql.DB) ([]*Route, error) {
+	var result []*Route
+
+	routes, err := Catalog(db)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := activePermissions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range routes {
+		if !r.Registered || reachable(r, permissions) {
+			continue
+		}
+
+		result = append(result, r)
+	}
+
+	return result, nil
+}
+
+func reachable(r *Route, permissions []*Permission) bool {
+	for _, p := range permissions {
+		if p.Effect == EffectAllow && MatchMethod(p.Method, r.Method) && MatchPattern(p.URL, r.Path) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,270 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+
+	audit "github.com/Mictrlan/Miuer/audit/model/mysql"
+)
+
+const (
+	mysqlDataScopeCreateTable = iota
+	mysqlDataScopeInsert
+	mysqlDataScopeDelete
+	mysqlDataScopeGetByRole
+	mysqlDataScopeGetActive
+)
+
+const (
+	// ScopeOrderUser restricts the orders to the ones of the users in values
+	ScopeOrderUser = "order.user_id"
+
+	// ScopeCategoryParent restricts the categories to the ones under the categories in values
+	ScopeCategoryParent = "category.parent_id"
+)
+
+type (
+	// DataScope maps a scope kind to the values that the records are restricted to, a kind missing
+	// in it is unrestricted. Of the roles an admin holds, a role with permissions but no rule of a kind
+	// leaves the kind unrestricted, otherwise the kind is restricted to the values of all the rules of
+	// it. A role inherits the rules and permissions of its parents and is scoped as a whole, a role
+	// without permissions is ignored.
+	DataScope map[string][]uint64
+
+	// DataScopeRule restricts the records of Kind that RoleID can see to Value
+	DataScopeRule struct {
+		RoleID    uint32
+		Kind      string
+		Value     uint64
+		CreatedAt string
+	}
+)
+
+var (
+	errInvalidScopeKind = errors.New("unknown data scope kind")
+
+	scopeKinds = map[string]bool{
+		ScopeOrderUser:      true,
+		ScopeCategoryParent: true,
+	}
+
+	dataScopeSQLString = []string{
+		`CREATE TABLE IF NOT EXISTS admin.data_scope (
+			role_id         INT UNSIGNED NOT NULL,
+			kind            VARCHAR(32) NOT NULL,
+			value           BIGINT UNSIGNED NOT NULL,
+			created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (role_id,kind,value)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;`,
+		`INSERT INTO admin.data_scope(role_id,kind,value) VALUES (?,?,?)`,
+		`DELETE FROM admin.data_scope WHERE role_id = ? AND kind = ? AND value = ? LIMIT 1`,
+		`SELECT role_id,kind,value,created_at FROM admin.data_scope WHERE role_id = ? ORDER BY kind,value LOCK IN SHARE MODE`,
+		`SELECT data_scope.role_id,data_scope.kind,data_scope.value FROM admin.data_scope, admin.role WHERE role.active = true AND data_scope.role_id = role.id LOCK IN SHARE MODE`,
+	}
+)
+
+// CreateDataScopeTable create data scope table.
+func CreateDataScopeTable(db *sql.DB) error {
+	_, err := db.Exec(dataScopeSQLString[mysqlDataScopeCreateTable])
+	return err
+}
+
+// AddDataScope restrict the records of kind that the role can see to value, the rules of a kind
+// are united, e.g. the orders of user 1 or user 2. entry is recorded in the same transaction.
+func AddDataScope(db *sql.DB, rid uint32, kind string, value uint64, entry *audit.Entry) error {
+	defer InvalidateCache()
+
+	if !scopeKinds[kind] {
+		return errInvalidScopeKind
+	}
+
+	role, err := GetRoleByID(db, rid)
+	if err != nil {
+		return err
+	}
+
+	if !role.Active {
+		return errRoleInactive
+	}
+
+	return audit.Transact(db, entry, func(tx *sql.Tx) error {
+		result, err := tx.Exec(dataScopeSQLString[mysqlDataScopeInsert], rid, kind, value)
+		if err != nil {
+			return err
+		}
+
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return errInvalidMysql
+		}
+
+		return entry.Describe(auditDataScopeAdd, auditTargetRole, rid).Change(nil, &DataScopeRule{RoleID: rid, Kind: kind, Value: value})
+	})
+}
+
+// RemoveDataScope remove a data scope rule of the role, entry is recorded in the same transaction.
+func RemoveDataScope(db *sql.DB, rid uint32, kind string, value uint64, entry *audit.Entry) error {
+	defer InvalidateCache()
+
+	return audit.Transact(db, entry, func(tx *sql.Tx) error {
+		result, err := tx.Exec(dataScopeSQLString[mysqlDataScopeDelete], rid, kind, value)
+		if err != nil {
+			return err
+		}
+
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return nil
+		}
+
+		return entry.Describe(auditDataScopeRemove, auditTargetRole, rid).Change(&DataScopeRule{RoleID: rid, Kind: kind, Value: value}, nil)
+	})
+}
+
+// DataScopes lists the data scope rules of the role, the inherited ones are not included.
+func DataScopes(db *sql.DB, rid uint32) ([]*DataScopeRule, error) {
+	var result []*DataScopeRule
+
+	rows, err := db.Query(dataScopeSQLString[mysqlDataScopeGetByRole], rid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var r DataScopeRule
+
+		if err := rows.Scan(&r.RoleID, &r.Kind, &r.Value, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		result = append(result, &r)
+	}
+
+	return result, rows.Err()
+}
+
+func activeDataScopes(db *sql.DB) ([]*DataScopeRule, error) {
+	var result []*DataScopeRule
+
+	rows, err := db.Query(dataScopeSQLString[mysqlDataScopeGetActive])
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var r DataScopeRule
+
+		if err := rows.Scan(&r.RoleID, &r.Kind, &r.Value); err != nil {
+			return nil, err
+		}
+
+		result = append(result, &r)
+	}
+
+	return result, rows.Err()
+}
+
+// CachedDataScope return the data scope of the roles and the roles they inherit, see DataScope.
+func CachedDataScope(db *sql.DB, roles map[uint32]bool) (DataScope, error) {
+	s, err := cachedSnapshot(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.dataScope(roles), nil
+}
+
+// dataScope combine the data scopes of the held roles, each role is scoped by its own rules and the
+// rules of the roles it inherits, and a role inherited by another held role only counts through it. A role with permissions but no rule of a kind can see all the records
+// of kind, so the kind is unrestricted. Otherwise the kind is restricted to the union of the values of
+// the restricted roles, the roles without any permission grant nothing and are skipped.
+func (s *snapshot) dataScope(roles map[uint32]bool) DataScope {
+	var (
+		held       = s.graph.ancestors(roles)
+		granting   = make(map[uint32]bool)
+		rules      = make(map[uint32][]*DataScopeRule)
+		unlimited  = make(map[string]bool)
+		seen       = make(map[string]map[uint64]bool)
+		restricted = make(DataScope)
+	)
+
+	for _, p := range s.permissions {
+		if p.Effect == EffectAllow {
+			granting[p.RoleID] = true
+		}
+	}
+
+	for _, r := range s.scopes {
+		rules[r.RoleID] = append(rules[r.RoleID], r)
+	}
+
+	closures := make(map[uint32]map[uint32]bool, len(held))
+	for rid := range held {
+		closures[rid] = s.graph.ancestors(map[uint32]bool{rid: true})
+	}
+
+	// a role inherited by another held role is scoped through that role
+	parents := make(map[uint32]bool)
+	for rid, inherited := range closures {
+		for id := range inherited {
+			if id != rid {
+				parents[id] = true
+			}
+		}
+	}
+
+	for rid, inherited := range closures {
+		var (
+			kinds  = make(map[string]bool)
+			grants bool
+		)
+
+		if parents[rid] {
+			continue
+		}
+
+		for id := range inherited {
+			grants = grants || granting[id]
+		}
+
+		if !grants {
+			continue
+		}
+
+		for id := range inherited {
+			for _, r := range rules[id] {
+				kinds[r.Kind] = true
+
+				if seen[r.Kind] == nil {
+					seen[r.Kind] = make(map[uint64]bool)
+				}
+
+				if !seen[r.Kind][r.Value] {
+					seen[r.Kind][r.Value] = true
+					restricted[r.Kind] = append(restricted[r.Kind], r.Value)
+				}
+			}
+		}
+
+		for kind := range scopeKinds {
+			if !kinds[kind] {
+				unlimited[kind] = true
+			}
+		}
+	}
+
+	for kind := range restricted {
+		if unlimited[kind] {
+			delete(restricted, kind)
+			continue
+		}
+
+		values := restricted[kind]
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	}
+
+	return restricted
+}
@@ -0,0 +1,87 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotDataScope(t *testing.T) {
+	// 1 sells to users 10 and 11, 2 sells to user 12, 3 sees every order, 4 only narrows categories
+	// without permissions, 5 inherits the permissions of 3 and is restricted to user 13, 6 inherits
+	// the permissions and rules of 1, 7 only denies, 8 sees the orders of user 14 in every category
+	s := &snapshot{
+		permissions: []*Permission{
+			{RoleID: 1, Method: AnyMethod, URL: "/api/v1/order/*", Effect: EffectAllow},
+			{RoleID: 2, Method: AnyMethod, URL: "/api/v1/order/*", Effect: EffectAllow},
+			{RoleID: 3, Method: AnyMethod, URL: "/api/v1/*", Effect: EffectAllow},
+			{RoleID: 7, Method: AnyMethod, URL: "/api/v1/order/*", Effect: EffectDeny},
+			{RoleID: 8, Method: AnyMethod, URL: "/api/v1/*", Effect: EffectAllow},
+		},
+		scopes: []*DataScopeRule{
+			{RoleID: 1, Kind: ScopeOrderUser, Value: 11},
+			{RoleID: 1, Kind: ScopeOrderUser, Value: 10},
+			{RoleID: 1, Kind: ScopeCategoryParent, Value: 100},
+			{RoleID: 2, Kind: ScopeOrderUser, Value: 12},
+			{RoleID: 2, Kind: ScopeOrderUser, Value: 10},
+			{RoleID: 2, Kind: ScopeCategoryParent, Value: 200},
+			{RoleID: 4, Kind: ScopeCategoryParent, Value: 400},
+			{RoleID: 5, Kind: ScopeOrderUser, Value: 13},
+			{RoleID: 5, Kind: ScopeCategoryParent, Value: 500},
+			{RoleID: 7, Kind: ScopeOrderUser, Value: 70},
+			{RoleID: 7, Kind: ScopeCategoryParent, Value: 700},
+			{RoleID: 8, Kind: ScopeOrderUser, Value: 14},
+		},
+		graph: roleGraph{
+			5: {3},
+			6: {1},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		roles map[uint32]bool
+		want  DataScope
+	}{
+		{"no roles", roleSet(), DataScope{}},
+		{"restricted", roleSet(1), DataScope{
+			ScopeOrderUser:      {10, 11},
+			ScopeCategoryParent: {100},
+		}},
+		{"union of restricted roles", roleSet(1, 2), DataScope{
+			ScopeOrderUser:      {10, 11, 12},
+			ScopeCategoryParent: {100, 200},
+		}},
+		{"unrestricted role", roleSet(3), DataScope{}},
+		{"unrestricted role with restricted one", roleSet(1, 3), DataScope{}},
+		{"role without permissions is ignored", roleSet(1, 4), DataScope{
+			ScopeOrderUser:      {10, 11},
+			ScopeCategoryParent: {100},
+		}},
+		{"only a role without permissions", roleSet(4), DataScope{}},
+		{"deny only role is ignored", roleSet(1, 7), DataScope{
+			ScopeOrderUser:      {10, 11},
+			ScopeCategoryParent: {100},
+		}},
+		{"inherited permissions are scoped by the child", roleSet(5), DataScope{
+			ScopeOrderUser:      {13},
+			ScopeCategoryParent: {500},
+		}},
+		{"inherited rules", roleSet(6), DataScope{
+			ScopeOrderUser:      {10, 11},
+			ScopeCategoryParent: {100},
+		}},
+		{"inherited roles in the held roles", roleSet(3, 5), DataScope{
+			ScopeOrderUser:      {13},
+			ScopeCategoryParent: {500},
+		}},
+		{"one kind unrestricted", roleSet(2, 8), DataScope{
+			ScopeOrderUser: {10, 12, 14},
+		}},
+	}
+
+	for _, tt := range tests {
+		if got := s.dataScope(tt.roles); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: dataScope = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
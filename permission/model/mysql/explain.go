@@ -0,0 +1,114 @@
+package mysql
+
+import (
+	"database/sql"
+	"sort"
+)
+
+const (
+	// ReasonDenied - a deny rule held by the roles matches
+	ReasonDenied = "denied by a deny rule"
+
+	// ReasonAllowed - an allow rule held by the roles matches and no deny rule does
+	ReasonAllowed = "allowed by an allow rule"
+
+	// ReasonNoRule - no allow rule held by the roles matches
+	ReasonNoRule = "no allow rule of the roles matches"
+)
+
+// Decision is the result of evaluating the rules of roles against a request.
+// Roles are the roles evaluated including the inherited ones, Rules are the matched rules
+// held by them, a deny rule overrides all the allow rules.
+type Decision struct {
+	Allowed bool
+	Reason  string
+	Roles   []uint32
+	Rules   []*Permission
+}
+
+// CachedEvaluate evaluate the cached rules of the roles and the roles they inherit against
+// the method and path of request, named permissions are evaluated with AnyMethod.
+func CachedEvaluate(db *sql.DB, roles map[uint32]bool, method, path string) (*Decision, error) {
+	s, err := cachedSnapshot(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.evaluate(roles, method, path), nil
+}
+
+func (s *snapshot) evaluate(roles map[uint32]bool, method, path string) *Decision {
+	var (
+		d       = &Decision{Reason: ReasonNoRule}
+		held    = s.graph.ancestors(roles)
+		allowed bool
+		denied  bool
+	)
+
+	for rid := range held {
+		d.Roles = append(d.Roles, rid)
+	}
+
+	sort.Slice(d.Roles, func(i, j int) bool { return d.Roles[i] < d.Roles[j] })
+
+	for _, p := range s.permissions {
+		if !held[p.RoleID] || !MatchMethod(p.Method, method) || !MatchPattern(p.URL, path) {
+			continue
+		}
+
+		d.Rules = append(d.Rules, p)
+
+		switch p.Effect {
+		case EffectDeny:
+			denied = true
+		case EffectAllow:
+			allowed = true
+		}
+	}
+
+	switch {
+	case denied:
+		d.Reason = ReasonDenied
+	case allowed:
+		d.Allowed = true
+		d.Reason = ReasonAllowed
+	}
+
+	return d
+}
+
+// CachedLiftedDenies return the cached deny rules held by the roles from, including the inherited
+// ones, that the roles to don't hold, e.g. the denies an admin escapes by impersonating another one.
+// A deny rule is held if a role of to has a deny rule of the same method and url.
+func CachedLiftedDenies(db *sql.DB, from, to map[uint32]bool) ([]*Permission, error) {
+	s, err := cachedSnapshot(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.liftedDenies(from, to), nil
+}
+
+func (s *snapshot) liftedDenies(from, to map[uint32]bool) []*Permission {
+	var (
+		lifted []*Permission
+
+		fromHeld = s.graph.ancestors(from)
+		toHeld   = s.graph.ancestors(to)
+		kept     = make(map[[2]string]bool)
+	)
+
+	for _, p := range s.permissions {
+		if p.Effect == EffectDeny && toHeld[p.RoleID] {
+			kept[[2]string{p.Method, p.URL}] = true
+		}
+	}
+
+	for _, p := range s.permissions {
+		if p.Effect == EffectDeny && fromHeld[p.RoleID] && !kept[[2]string{p.Method, p.URL}] {
+			lifted = append(lifted, p)
+		}
+	}
+
+	return lifted
+}
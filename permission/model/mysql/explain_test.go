@@ -0,0 +1,94 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSnapshotEvaluate(t *testing.T) {
+	// 3 inherits from 1, 2 is an auditor denied the order changes
+	s := &snapshot{
+		permissions: []*Permission{
+			{RoleID: 1, Method: AnyMethod, URL: "/api/v1/order/*", Effect: EffectAllow},
+			{RoleID: 2, Method: AnyMethod, URL: "/api/v1/*", Effect: EffectAllow},
+			{RoleID: 2, Method: "POST", URL: "/api/v1/order/status", Effect: EffectDeny},
+			{RoleID: 3, Method: "POST", URL: "/api/v1/order/create", Effect: EffectDeny},
+			{RoleID: 4, Method: AnyMethod, URL: "admin:manage", Effect: EffectAllow},
+		},
+		graph: roleGraph{3: {1}},
+	}
+
+	tests := []struct {
+		name    string
+		roles   map[uint32]bool
+		method  string
+		path    string
+		allowed bool
+		reason  string
+		held    []uint32
+		rules   int
+	}{
+		{"allowed", roleSet(1), "POST", "/api/v1/order/info", true, ReasonAllowed, []uint32{1}, 1},
+		{"no rule", roleSet(1), "POST", "/api/v1/category/create", false, ReasonNoRule, []uint32{1}, 0},
+		{"no roles", roleSet(), "POST", "/api/v1/order/info", false, ReasonNoRule, nil, 0},
+		{"deny of the same role", roleSet(2), "POST", "/api/v1/order/status", false, ReasonDenied, []uint32{2}, 2},
+		{"deny of another method", roleSet(2), "GET", "/api/v1/order/status", true, ReasonAllowed, []uint32{2}, 1},
+		{"deny over allow of another role", roleSet(1, 2), "POST", "/api/v1/order/status", false, ReasonDenied, []uint32{1, 2}, 3},
+		{"inherited allow", roleSet(3), "POST", "/api/v1/order/info", true, ReasonAllowed, []uint32{1, 3}, 1},
+		{"own deny over inherited allow", roleSet(3), "POST", "/api/v1/order/create", false, ReasonDenied, []uint32{1, 3}, 2},
+		{"named permission", roleSet(4), "GET", "admin:manage", true, ReasonAllowed, []uint32{4}, 1},
+	}
+
+	for _, tt := range tests {
+		d := s.evaluate(tt.roles, tt.method, tt.path)
+
+		if d.Allowed != tt.allowed || d.Reason != tt.reason {
+			t.Errorf("%s: evaluate = (%v, %q), want (%v, %q)", tt.name, d.Allowed, d.Reason, tt.allowed, tt.reason)
+		}
+
+		if !reflect.DeepEqual(d.Roles, tt.held) {
+			t.Errorf("%s: roles = %v, want %v", tt.name, d.Roles, tt.held)
+		}
+
+		if len(d.Rules) != tt.rules {
+			t.Errorf("%s: %d rules matched, want %d", tt.name, len(d.Rules), tt.rules)
+		}
+	}
+}
+
+func TestSnapshotLiftedDenies(t *testing.T) {
+	// 2 denies the order changes, 3 inherits from 2, 4 denies them too, 5 denies another method
+	s := &snapshot{
+		permissions: []*Permission{
+			{RoleID: 1, Method: AnyMethod, URL: "/api/v1/*", Effect: EffectAllow},
+			{RoleID: 2, Method: AnyMethod, URL: "/api/v1/*", Effect: EffectAllow},
+			{RoleID: 2, Method: "POST", URL: "/api/v1/order/status", Effect: EffectDeny},
+			{RoleID: 4, Method: "POST", URL: "/api/v1/order/status", Effect: EffectDeny},
+			{RoleID: 5, Method: "GET", URL: "/api/v1/order/status", Effect: EffectDeny},
+		},
+		graph: roleGraph{3: {2}},
+	}
+
+	tests := []struct {
+		name   string
+		from   map[uint32]bool
+		to     map[uint32]bool
+		lifted int
+	}{
+		{"no denies", roleSet(1), roleSet(1), 0},
+		{"same roles", roleSet(1, 2), roleSet(1, 2), 0},
+		{"target without the deny", roleSet(1, 2), roleSet(1), 1},
+		{"no target roles", roleSet(2), roleSet(), 1},
+		{"inherited deny", roleSet(1, 3), roleSet(1), 1},
+		{"deny held through inheritance", roleSet(2), roleSet(3), 0},
+		{"same deny of another role", roleSet(2), roleSet(4), 0},
+		{"deny of another method", roleSet(2), roleSet(5), 1},
+		{"target with more denies", roleSet(1), roleSet(2), 0},
+	}
+
+	for _, tt := range tests {
+		if lifted := s.liftedDenies(tt.from, tt.to); len(lifted) != tt.lifted {
+			t.Errorf("%s: liftedDenies = %v, want %d lifted", tt.name, lifted, tt.lifted)
+		}
+	}
+}
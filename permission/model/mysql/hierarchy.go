@@ -0,0 +1,258 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	audit "github.com/Mictrlan/Miuer/audit/model/mysql"
+)
+
+const (
+	mysqlRoleParentCreateTable = iota
+	mysqlRoleParentInsert
+	mysqlRoleParentDelete
+	mysqlRoleParentGetActive
+	mysqlRoleParentLockAll
+	mysqlRoleParentGetByRole
+)
+
+var (
+	errRoleCycle      = errors.New("the parent role inherits from the role")
+	errRoleSelfParent = errors.New("a role can't be its own parent")
+
+	roleParentSQLString = []string{
+		`CREATE TABLE IF NOT EXISTS admin.role_parent (
+			role_id         INT UNSIGNED NOT NULL,
+			parent_id       INT UNSIGNED NOT NULL,
+			created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (role_id,parent_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;`,
+		`INSERT INTO admin.role_parent(role_id,parent_id,created_at) VALUES (?,?,?)`,
+		`DELETE FROM admin.role_parent WHERE role_id = ? AND parent_id = ? LIMIT 1`,
+		`SELECT role_parent.role_id,role_parent.parent_id FROM admin.role_parent, admin.role AS child, admin.role AS parent WHERE role_parent.role_id = child.id AND role_parent.parent_id = parent.id AND child.active = true AND parent.active = true LOCK IN SHARE MODE`,
+		`SELECT role_id,parent_id FROM admin.role_parent FOR UPDATE`,
+		`SELECT parent_id FROM admin.role_parent WHERE role_id = ? LOCK IN SHARE MODE`,
+	}
+)
+
+// roleGraph maps a role to its parent roles
+type roleGraph map[uint32][]uint32
+
+// CreateRoleParentTable create role inheritance table.
+func CreateRoleParentTable(db *sql.DB) error {
+	_, err := db.Exec(roleParentSQLString[mysqlRoleParentCreateTable])
+	return err
+}
+
+// AddRoleParent let the role inherit all the permissions of parent, a cycle is refused.
+// entry is recorded in the same transaction.
+func AddRoleParent(db *sql.DB, rid, pid uint32, entry *audit.Entry) error {
+	defer InvalidateCache()
+
+	if rid == pid {
+		return errRoleSelfParent
+	}
+
+	for _, id := range []uint32{rid, pid} {
+		role, err := GetRoleByID(db, id)
+		if err != nil {
+			return err
+		}
+
+		if !role.Active {
+			return errRoleInactive
+		}
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	rows, err := tx.Query(roleParentSQLString[mysqlRoleParentLockAll])
+	if err != nil {
+		return err
+	}
+
+	graph, err := scanRoleGraph(rows)
+	if err != nil {
+		return err
+	}
+
+	if graph.ancestors(map[uint32]bool{pid: true})[rid] {
+		err = errRoleCycle
+		return err
+	}
+
+	result, err := tx.Exec(roleParentSQLString[mysqlRoleParentInsert], rid, pid, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		err = errInvalidMysql
+		return err
+	}
+
+	err = entry.Describe(auditParentAdd, auditTargetRole, rid).Change(nil, &roleParent{RoleID: rid, ParentID: pid})
+	if err != nil {
+		return err
+	}
+
+	err = audit.Record(tx, entry)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+// RemoveRoleParent stop the role inheriting from parent, entry is recorded in the same transaction.
+func RemoveRoleParent(db *sql.DB, rid, pid uint32, entry *audit.Entry) error {
+	defer InvalidateCache()
+
+	return audit.Transact(db, entry, func(tx *sql.Tx) error {
+		result, err := tx.Exec(roleParentSQLString[mysqlRoleParentDelete], rid, pid)
+		if err != nil {
+			return err
+		}
+
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return nil
+		}
+
+		return entry.Describe(auditParentRemove, auditTargetRole, rid).Change(&roleParent{RoleID: rid, ParentID: pid}, nil)
+	})
+}
+
+// RoleParents lists the direct parent roles of the role.
+func RoleParents(db *sql.DB, rid uint32) ([]uint32, error) {
+	var (
+		parentID uint32
+		result   []uint32
+	)
+
+	rows, err := db.Query(roleParentSQLString[mysqlRoleParentGetByRole], rid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := rows.Scan(&parentID); err != nil {
+			return nil, err
+		}
+
+		result = append(result, parentID)
+	}
+
+	return result, rows.Err()
+}
+
+// InheritedRoles return the roles and all their active ancestors, which are the roles
+// whose permissions the roles have.
+func InheritedRoles(db *sql.DB, roles map[uint32]bool) (map[uint32]bool, error) {
+	graph, err := activeRoleGraph(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return graph.ancestors(roles), nil
+}
+
+// InheritingRoles return the roles and all their active descendants, which are the roles
+// that have the permissions of the roles.
+func InheritingRoles(db *sql.DB, roles map[uint32]bool) (map[uint32]bool, error) {
+	graph, err := activeRoleGraph(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return graph.descendants(roles), nil
+}
+
+func activeRoleGraph(db *sql.DB) (roleGraph, error) {
+	rows, err := db.Query(roleParentSQLString[mysqlRoleParentGetActive])
+	if err != nil {
+		return nil, err
+	}
+
+	return scanRoleGraph(rows)
+}
+
+func scanRoleGraph(rows *sql.Rows) (roleGraph, error) {
+	var (
+		roleID, parentID uint32
+		graph            = make(roleGraph)
+	)
+
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := rows.Scan(&roleID, &parentID); err != nil {
+			return nil, err
+		}
+
+		graph[roleID] = append(graph[roleID], parentID)
+	}
+
+	return graph, rows.Err()
+}
+
+// ancestors walk up from the roles, the result includes the roles
+func (g roleGraph) ancestors(roles map[uint32]bool) map[uint32]bool {
+	return walk(roles, func(rid uint32) []uint32 {
+		return g[rid]
+	})
+}
+
+// descendants walk down from the roles, the result includes the roles
+func (g roleGraph) descendants(roles map[uint32]bool) map[uint32]bool {
+	children := make(map[uint32][]uint32)
+	for rid, parents := range g {
+		for _, pid := range parents {
+			children[pid] = append(children[pid], rid)
+		}
+	}
+
+	return walk(roles, func(rid uint32) []uint32 {
+		return children[rid]
+	})
+}
+
+func walk(roles map[uint32]bool, next func(uint32) []uint32) map[uint32]bool {
+	var (
+		result = make(map[uint32]bool)
+		queue  []uint32
+	)
+
+	for rid := range roles {
+		if roles[rid] {
+			result[rid] = true
+			queue = append(queue, rid)
+		}
+	}
+
+	for len(queue) > 0 {
+		rid := queue[0]
+		queue = queue[1:]
+
+		for _, id := range next(rid) {
+			if !result[id] {
+				result[id] = true
+				queue = append(queue, id)
+			}
+		}
+	}
+
+	return result
+}
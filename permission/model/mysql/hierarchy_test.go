@@ -0,0 +1,107 @@
+package mysql
+
+import (
+	"reflect"
+	"testing"
+)
+
+func roleSet(ids ...uint32) map[uint32]bool {
+	set := make(map[uint32]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+
+	return set
+}
+
+func TestRoleGraphAncestors(t *testing.T) {
+	// 4 inherits from 2 and 3, both inherit from 1, 5 is alone
+	graph := roleGraph{
+		2: {1},
+		3: {1},
+		4: {2, 3},
+	}
+
+	tests := []struct {
+		name  string
+		roles map[uint32]bool
+		want  map[uint32]bool
+	}{
+		{"none", roleSet(), roleSet()},
+		{"root", roleSet(1), roleSet(1)},
+		{"one parent", roleSet(2), roleSet(1, 2)},
+		{"diamond", roleSet(4), roleSet(1, 2, 3, 4)},
+		{"without parents", roleSet(5), roleSet(5)},
+		{"several", roleSet(2, 5), roleSet(1, 2, 5)},
+		{"false is not held", map[uint32]bool{2: true, 4: false}, roleSet(1, 2)},
+	}
+
+	for _, tt := range tests {
+		if got := graph.ancestors(tt.roles); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: ancestors = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRoleGraphDescendants(t *testing.T) {
+	graph := roleGraph{
+		2: {1},
+		3: {1},
+		4: {2, 3},
+	}
+
+	tests := []struct {
+		name  string
+		roles map[uint32]bool
+		want  map[uint32]bool
+	}{
+		{"root", roleSet(1), roleSet(1, 2, 3, 4)},
+		{"middle", roleSet(3), roleSet(3, 4)},
+		{"leaf", roleSet(4), roleSet(4)},
+	}
+
+	for _, tt := range tests {
+		if got := graph.descendants(tt.roles); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: descendants = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// TestRoleGraphCycle covers the check of AddRoleParent, rid can't inherit from pid when rid is
+// already an ancestor of pid
+func TestRoleGraphCycle(t *testing.T) {
+	graph := roleGraph{
+		2: {1},
+		3: {2},
+	}
+
+	tests := []struct {
+		name     string
+		rid, pid uint32
+		cycle    bool
+	}{
+		{"new parent", 4, 3, false},
+		{"shortcut", 3, 1, false},
+		{"direct back edge", 1, 2, true},
+		{"indirect back edge", 1, 3, true},
+		{"self through chain", 2, 3, true},
+	}
+
+	for _, tt := range tests {
+		if got := graph.ancestors(roleSet(tt.pid))[tt.rid]; got != tt.cycle {
+			t.Errorf("%s: %d inheriting from %d is a cycle = %v, want %v", tt.name, tt.rid, tt.pid, got, tt.cycle)
+		}
+	}
+}
+
+func TestRoleGraphAncestorsTerminatesOnCycle(t *testing.T) {
+	graph := roleGraph{
+		1: {3},
+		2: {1},
+		3: {2},
+	}
+
+	if got, want := graph.ancestors(roleSet(1)), roleSet(1, 2, 3); !reflect.DeepEqual(got, want) {
+		t.Errorf("ancestors = %v, want %v", got, want)
+	}
+}
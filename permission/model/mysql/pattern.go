@@ -0,0 +1,56 @@
+package mysql
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchMethod report whether the method of a permission matches the request method
+func MatchMethod(pattern, method string) bool {
+	return pattern == AnyMethod || strings.EqualFold(pattern, method)
+}
+
+// MatchPattern report whether a gin style route pattern matches the request path.
+//
+// A ":name" segment matches exactly one segment and a last "*" or "*name" segment matches
+// the rest of path, including nothing. The other segments may be globs of path.Match, which
+// never cross "/". A pattern without any of them must equal the path.
+func MatchPattern(pattern, urlPath string) bool {
+	if pattern == urlPath {
+		return true
+	}
+
+	if !strings.HasPrefix(pattern, "/") {
+		return false
+	}
+
+	patterns := strings.Split(pattern, "/")
+	segments := strings.Split(urlPath, "/")
+
+	for i, p := range patterns {
+		if strings.HasPrefix(p, "*") && i == len(patterns)-1 {
+			return len(segments) >= i
+		}
+
+		if i >= len(segments) {
+			return false
+		}
+
+		switch {
+		case strings.HasPrefix(p, ":"):
+			if segments[i] == "" {
+				return false
+			}
+		case strings.ContainsAny(p, `*?[\`):
+			if ok, err := path.Match(p, segments[i]); err != nil || !ok {
+				return false
+			}
+		default:
+			if p != segments[i] {
+				return false
+			}
+		}
+	}
+
+	return len(patterns) == len(segments)
+}
@@ -0,0 +1,75 @@
+package mysql
+
+import "testing"
+
+func TestMatchMethod(t *testing.T) {
+	tests := []struct {
+		pattern string
+		method  string
+		want    bool
+	}{
+		{AnyMethod, "GET", true},
+		{AnyMethod, "POST", true},
+		{"POST", "POST", true},
+		{"post", "POST", true},
+		{"POST", "post", true},
+		{"GET", "POST", false},
+		{"", "GET", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchMethod(tt.pattern, tt.method); got != tt.want {
+			t.Errorf("MatchMethod(%q, %q) = %v, want %v", tt.pattern, tt.method, got, tt.want)
+		}
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		// exact
+		{"/api/v1/order/create", "/api/v1/order/create", true},
+		{"/api/v1/order/create", "/api/v1/order/info", false},
+		{"/api/v1/order/create", "/api/v1/order/create/", false},
+		{"/api/v1/order", "/api/v1/order/create", false},
+
+		// named permissions only match themselves
+		{"admin:manage", "admin:manage", true},
+		{"admin:manage", "/admin:manage", false},
+
+		// params match exactly one segment
+		{"/api/v1/order/:id", "/api/v1/order/12", true},
+		{"/api/v1/order/:id", "/api/v1/order/", false},
+		{"/api/v1/order/:id", "/api/v1/order", false},
+		{"/api/v1/order/:id", "/api/v1/order/12/items", false},
+		{"/api/v1/:module/list", "/api/v1/audit/list", true},
+
+		// a last catch-all matches the rest, including nothing
+		{"/api/v1/order/*", "/api/v1/order/create", true},
+		{"/api/v1/order/*", "/api/v1/order/12/items", true},
+		{"/api/v1/order/*", "/api/v1/order/", true},
+		{"/api/v1/order/*", "/api/v1/order", true},
+		{"/api/v1/order/*path", "/api/v1/order/12/items", true},
+		{"/api/v1/order/*", "/api/v1/category/create", false},
+		{"/api/v1/*/create", "/api/v1/order/create", true},
+		{"/api/v1/*/create", "/api/v1/order/12/create", false},
+
+		// globs never cross "/"
+		{"/api/v1/order/cre*", "/api/v1/order/create", true},
+		{"/api/v1/order/?nfo", "/api/v1/order/info", true},
+		{"/api/v1/order/[ci]*", "/api/v1/order/info", true},
+		{"/api/v1/order/[ci]*", "/api/v1/order/user", false},
+		{"/api/v1/*der/create", "/api/v1/order/create", true},
+		{"/api/v1/order/[", "/api/v1/order/[", true},
+		{"/api/v1/order/[x", "/api/v1/order/x", false},
+	}
+
+	for _, tt := range tests {
+		if got := MatchPattern(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("MatchPattern(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -4,6 +4,11 @@ package mysql
 
 import (
 	"database/sql"
+	"errors"
+	"net/http"
+	"strings"
+
+	audit "github.com/Mictrlan/Miuer/audit/model/mysql"
 )
 
 const (
@@ -12,40 +17,130 @@ const (
 	mysqlPermissionDelete
 	mysqlPermissonGetRole
 	mysqlPermissonGetAll
+	mysqlPermissionHasColumn
+	mysqlPermissionAddMethod
+	mysqlPermissionGetActive
+	mysqlPermissionAddEffect
+	mysqlPermissionLock
+)
+
+const (
+	// AnyMethod is the method of a permission that matches all the http methods, named permissions use it too
+	AnyMethod = "*"
+
+	// EffectAllow grants the roles the matched requests
+	EffectAllow = "allow"
+
+	// EffectDeny refuses the roles the matched requests even if an allow rule matches
+	EffectDeny = "deny"
 )
 
 // Permission -
 type (
 	Permission struct {
 		URL       string
+		Method    string
+		Effect    string
 		RoleID    uint32
 		CreatedAt string
 	}
 )
 
 var (
+	errInvalidMethod = errors.New("invalid http method")
+
+	methods = map[string]bool{
+		AnyMethod:          true,
+		http.MethodGet:     true,
+		http.MethodHead:    true,
+		http.MethodPost:    true,
+		http.MethodPut:     true,
+		http.MethodPatch:   true,
+		http.MethodDelete:  true,
+		http.MethodOptions: true,
+	}
+
 	permissionSQLString = []string{
 		`CREATE TABLE IF NOT EXISTS admin.permission (
 			url             VARCHAR(512) NOT NULL DEFAULT ' ',
 			role_id         MEDIUMINT UNSIGNED NOT NULL,
 			created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			PRIMARY KEY (url,role_id)
+			method          VARCHAR(16) NOT NULL DEFAULT '*',
+			effect          VARCHAR(8) NOT NULL DEFAULT 'allow',
+			PRIMARY KEY (url,method,role_id)
 		) ENGINE=InnoDB AUTO_INCREMENT=1000 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;`,
-		`INSERT INTO admin.permission(url,role_id) VALUES (?,?)`,
-		`DELETE FROM admin.permission WHERE role_id = ? AND url = ? LIMIT 1`, // 确保正确删除多对多情况下的 url 与 role_id
-		`SELECT permission.role_id FROM admin.permission, admin.role WHERE permission.url = ? AND role.active = true AND permission.role_id = role.id LOCK IN SHARE MODE`, // 同时满足全部条件才算成功
-		`SELECT * FROM admin.permission LOCK IN SHARE MODE`,
+		`INSERT INTO admin.permission(url,method,role_id,effect) VALUES (?,?,?,?)`,
+		`DELETE FROM admin.permission WHERE role_id = ? AND url = ? AND method = ? LIMIT 1`,                                                                                                               // 确保正确删除多对多情况下的 url 与 role_id
+		`SELECT permission.role_id FROM admin.permission, admin.role WHERE permission.url = ? AND permission.effect = 'allow' AND role.active = true AND permission.role_id = role.id LOCK IN SHARE MODE`, // 同时满足全部条件才算成功
+		`SELECT url,method,effect,role_id,created_at FROM admin.permission LOCK IN SHARE MODE`,
+		`SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = 'admin' AND TABLE_NAME = 'permission' AND COLUMN_NAME = ?`,
+		`ALTER TABLE admin.permission ADD COLUMN method VARCHAR(16) NOT NULL DEFAULT '*', DROP PRIMARY KEY, ADD PRIMARY KEY (url,method,role_id)`,
+		`SELECT permission.url,permission.method,permission.effect,permission.role_id FROM admin.permission, admin.role WHERE role.active = true AND permission.role_id = role.id LOCK IN SHARE MODE`,
+		`ALTER TABLE admin.permission ADD COLUMN effect VARCHAR(8) NOT NULL DEFAULT 'allow'`,
+		`SELECT effect FROM admin.permission WHERE role_id = ? AND url = ? AND method = ? FOR UPDATE`,
 	}
 )
 
-// CreatePermissionTable create permission table.
+// CreatePermissionTable create permission table, the columns added later are added to the table
+// created before, the existing urls match any method and allow.
 func CreatePermissionTable(db *sql.DB) error {
 	_, err := db.Exec(permissionSQLString[mysqlPermissionCreateTable])
+	if err != nil {
+		return err
+	}
+
+	err = addPermissionColumn(db, "method", mysqlPermissionAddMethod)
+	if err != nil {
+		return err
+	}
+
+	return addPermissionColumn(db, "effect", mysqlPermissionAddEffect)
+}
+
+func addPermissionColumn(db *sql.DB, column string, alter int) error {
+	var count int
+
+	err := db.QueryRow(permissionSQLString[mysqlPermissionHasColumn], column).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		_, err = db.Exec(permissionSQLString[alter])
+	}
+
 	return err
 }
 
-// AddURLPermission create an associated record of the specified URL and role.
+// AddURLPermission create an associated record of the specified URL and role for any method.
 func AddURLPermission(db *sql.DB, rid uint32, url string) error {
+	return AddPermission(db, rid, AnyMethod, url, EffectAllow, nil)
+}
+
+// RemoveURLPermission remove the associated records of the specified URL and role for any method.
+func RemoveURLPermission(db *sql.DB, rid uint32, url string) error {
+	return RemovePermission(db, rid, AnyMethod, url, nil)
+}
+
+// PermissionMethod normalize the method of a permission, empty means any method
+func PermissionMethod(method string) (string, error) {
+	if method == "" {
+		return AnyMethod, nil
+	}
+
+	method = strings.ToUpper(method)
+	if !methods[method] {
+		return "", errInvalidMethod
+	}
+
+	return method, nil
+}
+
+// AddPermission create an allow or deny rule of the specified method, URL pattern and role,
+// entry is recorded in the same transaction.
+func AddPermission(db *sql.DB, rid uint32, method, url, effect string, entry *audit.Entry) error {
+	defer InvalidateCache()
+
 	role, err := GetRoleByID(db, rid)
 	if err != nil {
 		return err
@@ -55,12 +150,21 @@ func AddURLPermission(db *sql.DB, rid uint32, url string) error {
 		return errRoleInactive
 	}
 
-	_, err = db.Exec(permissionSQLString[mysqlPermissionInstert], url, rid)
-	return err
+	return audit.Transact(db, entry, func(tx *sql.Tx) error {
+		_, err := tx.Exec(permissionSQLString[mysqlPermissionInstert], url, method, rid, effect)
+		if err != nil {
+			return err
+		}
+
+		return entry.Describe(auditPermissionAdd, auditTargetRole, rid).Change(nil, &Permission{URL: url, Method: method, Effect: effect, RoleID: rid})
+	})
 }
 
-// RemoveURLPermission remove the associated records of the specified URL and role.
-func RemoveURLPermission(db *sql.DB, rid uint32, url string) error {
+// RemovePermission remove the associated records of the specified method, URL pattern and role,
+// entry is recorded in the same transaction.
+func RemovePermission(db *sql.DB, rid uint32, method, url string, entry *audit.Entry) error {
+	defer InvalidateCache()
+
 	role, err := GetRoleByID(db, rid)
 	if err != nil {
 		return err
@@ -70,11 +174,28 @@ func RemoveURLPermission(db *sql.DB, rid uint32, url string) error {
 		return errRoleInactive
 	}
 
-	_, err = db.Exec(permissionSQLString[mysqlPermissionDelete], rid, url)
-	return err
+	return audit.Transact(db, entry, func(tx *sql.Tx) error {
+		before := &Permission{URL: url, Method: method, RoleID: rid}
+
+		err := tx.QueryRow(permissionSQLString[mysqlPermissionLock], rid, url, method).Scan(&before.Effect)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(permissionSQLString[mysqlPermissionDelete], rid, url, method)
+		if err != nil {
+			return err
+		}
+
+		return entry.Describe(auditPermissionRemove, auditTargetRole, rid).Change(before, nil)
+	})
 }
 
-// URLPermissions lists all the roles of the specified URL.
+// URLPermissions lists all the roles of the specified URL regardless of method, including the roles inheriting them.
 func URLPermissions(db *sql.DB, url string) (map[uint32]bool, error) {
 	var (
 		roleID uint32
@@ -95,7 +216,50 @@ func URLPermissions(db *sql.DB, url string) (map[uint32]bool, error) {
 		result[roleID] = true
 	}
 
-	return result, nil
+	return InheritingRoles(db, result)
+}
+
+// MatchPermissions lists all the active roles of the allow rules whose method and URL pattern match the request,
+// including the roles inheriting them.
+func MatchPermissions(db *sql.DB, method, path string) (map[uint32]bool, error) {
+	result := make(map[uint32]bool)
+
+	permissions, err := activePermissions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range permissions {
+		if p.Effect == EffectAllow && MatchMethod(p.Method, method) && MatchPattern(p.URL, path) {
+			result[p.RoleID] = true
+		}
+	}
+
+	return InheritingRoles(db, result)
+}
+
+// activePermissions lists the permissions of active roles without CreatedAt
+func activePermissions(db *sql.DB) ([]*Permission, error) {
+	var result []*Permission
+
+	rows, err := db.Query(permissionSQLString[mysqlPermissionGetActive])
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Permission
+
+		if err := rows.Scan(&p.URL, &p.Method, &p.Effect, &p.RoleID); err != nil {
+			return nil, err
+		}
+
+		result = append(result, &p)
+	}
+
+	return result, rows.Err()
 }
 
 // Permissions lists all the roles.
@@ -103,6 +267,8 @@ func Permissions(db *sql.DB) (*[]*Permission, error) {
 	var (
 		roleID    uint32
 		url       string
+		method    string
+		effect    string
 		createdAt string
 
 		result []*Permission
@@ -116,12 +282,14 @@ func Permissions(db *sql.DB) (*[]*Permission, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		if err = rows.Scan(&url, &roleID, &createdAt); err != nil {
+		if err = rows.Scan(&url, &method, &effect, &roleID, &createdAt); err != nil {
 			return nil, err
 		}
 
 		data := &Permission{
 			URL:       url,
+			Method:    method,
+			Effect:    effect,
 			RoleID:    roleID,
 			CreatedAt: createdAt,
 		}
@@ -131,3 +299,27 @@ func Permissions(db *sql.DB) (*[]*Permission, error) {
 
 	return &result, nil
 }
+
+// EffectivePermissions lists the permissions granted to the roles directly or through inheritance,
+// RoleID of a permission is the role it is granted to.
+func EffectivePermissions(db *sql.DB, roles map[uint32]bool) ([]*Permission, error) {
+	var result []*Permission
+
+	inherited, err := InheritedRoles(db, roles)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := Permissions(db)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range *permissions {
+		if inherited[p.RoleID] {
+			result = append(result, p)
+		}
+	}
+
+	return result, nil
+}
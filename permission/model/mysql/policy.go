@@ -0,0 +1,732 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	audit "github.com/Mictrlan/Miuer/audit/model/mysql"
+)
+
+const (
+	mysqlPolicyRoles = iota
+	mysqlPolicyPermissions
+	mysqlPolicyParents
+	mysqlPolicyGrants
+	mysqlPolicyAdmins
+	mysqlPolicyRoleUpdate
+	mysqlPolicyPermissionUpdate
+	mysqlPolicySelectRelation
+	mysqlPolicyDataScopes
+)
+
+const (
+	// PolicyVersion is the version of policy document written by ExportPolicy and read by ImportPolicy
+	PolicyVersion = 1
+
+	// policy changes
+	policyAdd    = "add"
+	policyRemove = "remove"
+	policyUpdate = "update"
+
+	policyKindRole       = "role"
+	policyKindPermission = "permission"
+	policyKindParent     = "parent"
+	policyKindGrant      = "grant"
+	policyKindDataScope  = "data_scope"
+
+	// datetimeLayout is the layout of DATETIME columns scanned as string
+	datetimeLayout = "2006-01-02 15:04:05"
+
+	errFmtPolicyRole         = "invalid role %q in policy"
+	errFmtPolicyDuplicate    = "duplicate role %q in policy"
+	errFmtPolicyRule         = "invalid permission %q of role %q in policy"
+	errFmtPolicyParent       = "unknown parent %q of role %q in policy"
+	errFmtPolicyCycle        = "role %q inherits from itself in policy"
+	errFmtPolicyGrant        = "invalid grant of admin %q to role %q in policy"
+	errFmtPolicyAdminUnknown = "unknown admin %q of role %q in policy"
+	errFmtPolicyDataScope    = "invalid data scope %q of role %q in policy"
+	errFmtPolicyRuleRefused  = "permission %q of role %q: %v"
+)
+
+type (
+	// Policy is the whole access policy, roles are identified by name and admins by name so that
+	// a policy can be shared by databases.
+	Policy struct {
+		Version int           `yaml:"version"`
+		Roles   []*PolicyRole `yaml:"roles"`
+	}
+
+	// PolicyRole is a role with its rules, data scopes, parent roles and grants
+	PolicyRole struct {
+		Name        string             `yaml:"name"`
+		Intro       string             `yaml:"intro"`
+		Inactive    bool               `yaml:"inactive,omitempty"`
+		Parents     []string           `yaml:"parents,omitempty"`
+		Permissions []*PolicyRule      `yaml:"permissions,omitempty"`
+		DataScopes  []*PolicyDataScope `yaml:"data_scopes,omitempty"`
+		Admins      []*PolicyGrant     `yaml:"admins,omitempty"`
+	}
+
+	// PolicyRule is a permission of role, the empty method is AnyMethod and the empty effect is EffectAllow
+	PolicyRule struct {
+		Method string `yaml:"method,omitempty"`
+		URL    string `yaml:"url"`
+		Effect string `yaml:"effect,omitempty"`
+	}
+
+	// PolicyDataScope is a data scope rule of role
+	PolicyDataScope struct {
+		Kind  string `yaml:"kind"`
+		Value uint64 `yaml:"value"`
+	}
+
+	// PolicyGrant is a role granted to an admin, the validity is in the layout "2006-01-02 15:04:05"
+	// and the empty one is unbounded
+	PolicyGrant struct {
+		Admin      string `yaml:"admin"`
+		ValidFrom  string `yaml:"valid_from,omitempty"`
+		ValidUntil string `yaml:"valid_until,omitempty"`
+	}
+
+	// PolicyChange is a difference between a policy and the database, Kind is one of role,
+	// permission, data_scope, parent and grant, Target is the permission, parent or admin changed in Role.
+	PolicyChange struct {
+		Action string
+		Kind   string
+		Role   string
+		Target string
+		Detail string
+	}
+
+	// PolicyErrors is the permissions of a policy refused by the method whitelist or the route catalog,
+	// ImportPolicy returns it with the changes on dry run and refuses the policy otherwise
+	PolicyErrors []string
+
+	// policyState is the policy of database and the ids of its roles and all the admins
+	policyState struct {
+		policy *Policy
+		roles  map[string]uint32
+		admins map[string]uint32
+	}
+
+	querier interface {
+		Query(query string, args ...interface{}) (*sql.Rows, error)
+	}
+)
+
+var (
+	errPolicyVersion = errors.New("unsupported policy version")
+
+	policySQLString = []string{
+		`SELECT id,name,intro,active FROM admin.role ORDER BY name LOCK IN SHARE MODE`,
+		`SELECT role_id,url,method,effect FROM admin.permission ORDER BY role_id,url,method LOCK IN SHARE MODE`,
+		`SELECT role_id,parent_id FROM admin.role_parent LOCK IN SHARE MODE`,
+		`SELECT relation.role_id,user.name,relation.valid_from,relation.valid_until FROM admin.relation, admin.user WHERE relation.admin_id = user.id ORDER BY relation.role_id,user.name LOCK IN SHARE MODE`,
+		`SELECT id,name FROM admin.user LOCK IN SHARE MODE`,
+		`UPDATE admin.role SET intro = ?, active = ? WHERE id = ? LIMIT 1`,
+		`UPDATE admin.permission SET effect = ? WHERE role_id = ? AND url = ? AND method = ? LIMIT 1`,
+		`SELECT admin_id,role_id,valid_from,valid_until FROM admin.relation WHERE admin_id = ? AND role_id = ? FOR UPDATE`,
+		`SELECT role_id,kind,value FROM admin.data_scope ORDER BY role_id,kind,value LOCK IN SHARE MODE`,
+	}
+)
+
+// ExportPolicy return all the roles with their permissions, data scopes, parent roles and grants.
+func ExportPolicy(db *sql.DB) (*Policy, error) {
+	state, err := loadPolicy(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return state.policy, nil
+}
+
+// ImportPolicy make the roles, permissions, data scopes, parent roles and grants of database the same as policy
+// in a transaction, the roles missing in policy are deleted with all their grants. The changes are
+// returned, with dryRun they are rolled back. A policy with a permission of unknown method or route is
+// refused with PolicyErrors, with dryRun the changes are returned with them. Unless dryRun, entry is
+// recorded in the same transaction with the policies before and after.
+func ImportPolicy(db *sql.DB, policy *Policy, dryRun bool, entry *audit.Entry) ([]*PolicyChange, error) {
+	err := normalizePolicy(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil || dryRun {
+			tx.Rollback()
+		}
+	}()
+
+	state, err := loadPolicy(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	routes, err := catalog(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	refused := checkPolicyRules(policy, routes)
+	if len(refused) > 0 && !dryRun {
+		err = refused
+		return nil, err
+	}
+
+	changes, err := applyPolicy(tx, state, policy, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	if dryRun {
+		if len(refused) > 0 {
+			return changes, refused
+		}
+
+		return changes, nil
+	}
+
+	if len(changes) > 0 {
+		err = entry.Describe(auditPolicyImport, auditTargetPolicy, PolicyVersion).Change(state.policy, policy)
+		if err != nil {
+			return nil, err
+		}
+
+		err = audit.Record(tx, entry)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	InvalidateCache()
+
+	return changes, nil
+}
+
+func loadPolicy(q querier) (*policyState, error) {
+	var (
+		state = &policyState{
+			policy: &Policy{Version: PolicyVersion},
+			roles:  make(map[string]uint32),
+			admins: make(map[string]uint32),
+		}
+		byID = make(map[uint32]*PolicyRole)
+	)
+
+	err := scanRows(q, policySQLString[mysqlPolicyRoles], func(rows *sql.Rows) error {
+		var (
+			id     uint32
+			active bool
+			r      PolicyRole
+		)
+
+		if err := rows.Scan(&id, &r.Name, &r.Intro, &active); err != nil {
+			return err
+		}
+
+		r.Inactive = !active
+		state.roles[r.Name] = id
+		byID[id] = &r
+		state.policy.Roles = append(state.policy.Roles, &r)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanRows(q, policySQLString[mysqlPolicyPermissions], func(rows *sql.Rows) error {
+		var (
+			rid uint32
+			p   PolicyRule
+		)
+
+		if err := rows.Scan(&rid, &p.URL, &p.Method, &p.Effect); err != nil {
+			return err
+		}
+
+		if r := byID[rid]; r != nil {
+			r.Permissions = append(r.Permissions, &p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanRows(q, policySQLString[mysqlPolicyDataScopes], func(rows *sql.Rows) error {
+		var (
+			rid uint32
+			d   PolicyDataScope
+		)
+
+		if err := rows.Scan(&rid, &d.Kind, &d.Value); err != nil {
+			return err
+		}
+
+		if r := byID[rid]; r != nil {
+			r.DataScopes = append(r.DataScopes, &d)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanRows(q, policySQLString[mysqlPolicyParents], func(rows *sql.Rows) error {
+		var rid, pid uint32
+
+		if err := rows.Scan(&rid, &pid); err != nil {
+			return err
+		}
+
+		if r, p := byID[rid], byID[pid]; r != nil && p != nil {
+			r.Parents = append(r.Parents, p.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanRows(q, policySQLString[mysqlPolicyGrants], func(rows *sql.Rows) error {
+		var (
+			rid                   uint32
+			validFrom, validUntil sql.NullString
+			g                     PolicyGrant
+		)
+
+		if err := rows.Scan(&rid, &g.Admin, &validFrom, &validUntil); err != nil {
+			return err
+		}
+
+		g.ValidFrom, g.ValidUntil = validFrom.String, validUntil.String
+		if r := byID[rid]; r != nil {
+			r.Admins = append(r.Admins, &g)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = scanRows(q, policySQLString[mysqlPolicyAdmins], func(rows *sql.Rows) error {
+		var (
+			id   uint32
+			name string
+		)
+
+		if err := rows.Scan(&id, &name); err != nil {
+			return err
+		}
+
+		state.admins[name] = id
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range state.policy.Roles {
+		sort.Strings(r.Parents)
+	}
+
+	return state, nil
+}
+
+func scanRows(q querier, query string, scan func(*sql.Rows) error) error {
+	rows, err := q.Query(query)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// normalizePolicy fill the default method and effect and check the policy, including the cycles
+// of role inheritance
+func normalizePolicy(policy *Policy) error {
+	if policy.Version != PolicyVersion {
+		return errPolicyVersion
+	}
+
+	var (
+		index = make(map[string]uint32)
+		graph = make(roleGraph)
+	)
+
+	for i, r := range policy.Roles {
+		if r.Name == "" {
+			return fmt.Errorf(errFmtPolicyRole, r.Name)
+		}
+
+		if _, exists := index[r.Name]; exists {
+			return fmt.Errorf(errFmtPolicyDuplicate, r.Name)
+		}
+
+		index[r.Name] = uint32(i + 1)
+	}
+
+	for _, r := range policy.Roles {
+		rules := make(map[string]bool)
+		for _, p := range r.Permissions {
+			p.Method = strings.ToUpper(p.Method)
+			if p.Method == "" {
+				p.Method = AnyMethod
+			}
+
+			p.Effect = strings.ToLower(p.Effect)
+			if p.Effect == "" {
+				p.Effect = EffectAllow
+			}
+
+			key := ruleKey(p)
+			if p.URL == "" || rules[key] || (p.Effect != EffectAllow && p.Effect != EffectDeny) {
+				return fmt.Errorf(errFmtPolicyRule, key, r.Name)
+			}
+
+			rules[key] = true
+		}
+
+		scopes := make(map[string]bool)
+		for _, d := range r.DataScopes {
+			key := scopeKey(d)
+			if !scopeKinds[d.Kind] || scopes[key] {
+				return fmt.Errorf(errFmtPolicyDataScope, key, r.Name)
+			}
+
+			scopes[key] = true
+		}
+
+		for _, parent := range r.Parents {
+			pid, exists := index[parent]
+			if !exists {
+				return fmt.Errorf(errFmtPolicyParent, parent, r.Name)
+			}
+
+			graph[index[r.Name]] = append(graph[index[r.Name]], pid)
+		}
+
+		admins := make(map[string]bool)
+		for _, g := range r.Admins {
+			if g.Admin == "" || admins[g.Admin] || !validDatetime(g.ValidFrom) || !validDatetime(g.ValidUntil) {
+				return fmt.Errorf(errFmtPolicyGrant, g.Admin, r.Name)
+			}
+
+			admins[g.Admin] = true
+		}
+	}
+
+	for _, r := range policy.Roles {
+		id := index[r.Name]
+		parents := make(map[uint32]bool)
+		for _, pid := range graph[id] {
+			parents[pid] = true
+		}
+
+		if graph.ancestors(parents)[id] {
+			return fmt.Errorf(errFmtPolicyCycle, r.Name)
+		}
+	}
+
+	return nil
+}
+
+// checkPolicyRules check the method of each permission against the whitelist and its method and URL
+// pattern against the registered routes of catalog as adding a permission does, the named permissions
+// are in catalog too
+func checkPolicyRules(policy *Policy, routes []*Route) PolicyErrors {
+	var refused PolicyErrors
+
+	for _, r := range policy.Roles {
+		for _, p := range r.Permissions {
+			switch {
+			case !methods[p.Method]:
+				refused = append(refused, fmt.Sprintf(errFmtPolicyRuleRefused, ruleKey(p), r.Name, errInvalidMethod))
+			case !knownRoute(routes, p.Method, p.URL):
+				refused = append(refused, fmt.Sprintf(errFmtPolicyRuleRefused, ruleKey(p), r.Name, errUnknownRoute))
+			}
+		}
+	}
+
+	return refused
+}
+
+func (e PolicyErrors) Error() string {
+	return strings.Join(e, "; ")
+}
+
+func validDatetime(value string) bool {
+	if value == "" {
+		return true
+	}
+
+	_, err := time.Parse(datetimeLayout, value)
+	return err == nil
+}
+
+func ruleKey(p *PolicyRule) string {
+	return p.Method + " " + p.URL
+}
+
+func scopeKey(d *PolicyDataScope) string {
+	return fmt.Sprintf("%s %d", d.Kind, d.Value)
+}
+
+func nullable(value string) interface{} {
+	if value == "" {
+		return nil
+	}
+
+	return value
+}
+
+// applyPolicy change the database in tx from state to policy and return the changes, the removal
+// of each grant is recorded as made by the actor of entry
+func applyPolicy(tx *sql.Tx, state *policyState, policy *Policy, entry *audit.Entry) ([]*PolicyChange, error) {
+	var (
+		changes []*PolicyChange
+		current = make(map[string]*PolicyRole)
+		desired = make(map[string]bool)
+		now     = time.Now()
+	)
+
+	change := func(action, kind, role, target, detail string) {
+		changes = append(changes, &PolicyChange{Action: action, Kind: kind, Role: role, Target: target, Detail: detail})
+	}
+
+	for _, r := range state.policy.Roles {
+		current[r.Name] = r
+	}
+
+	for _, r := range policy.Roles {
+		desired[r.Name] = true
+	}
+
+	for _, r := range state.policy.Roles {
+		if desired[r.Name] {
+			continue
+		}
+
+		if err := deleteRole(tx, state.roles[r.Name], entry); err != nil {
+			return nil, err
+		}
+
+		change(policyRemove, policyKindRole, r.Name, "", "")
+	}
+
+	for _, r := range policy.Roles {
+		old, exists := current[r.Name]
+		if !exists {
+			result, err := tx.Exec(roleSQLString[mysqlRoleInsert], r.Name, r.Intro, !r.Inactive)
+			if err != nil {
+				return nil, err
+			}
+
+			id, err := result.LastInsertId()
+			if err != nil {
+				return nil, err
+			}
+
+			state.roles[r.Name] = uint32(id)
+			old = &PolicyRole{Name: r.Name}
+			change(policyAdd, policyKindRole, r.Name, "", "")
+		} else if old.Intro != r.Intro || old.Inactive != r.Inactive {
+			_, err := tx.Exec(policySQLString[mysqlPolicyRoleUpdate], r.Intro, !r.Inactive, state.roles[r.Name])
+			if err != nil {
+				return nil, err
+			}
+
+			change(policyUpdate, policyKindRole, r.Name, "", fmt.Sprintf("intro %q, inactive %t", r.Intro, r.Inactive))
+		}
+
+		rid := state.roles[r.Name]
+
+		rules := make(map[string]*PolicyRule)
+		for _, p := range r.Permissions {
+			rules[ruleKey(p)] = p
+		}
+
+		for _, p := range old.Permissions {
+			want, exists := rules[ruleKey(p)]
+			switch {
+			case !exists:
+				if _, err := tx.Exec(permissionSQLString[mysqlPermissionDelete], rid, p.URL, p.Method); err != nil {
+					return nil, err
+				}
+
+				change(policyRemove, policyKindPermission, r.Name, ruleKey(p), p.Effect)
+			case want.Effect != p.Effect:
+				if _, err := tx.Exec(policySQLString[mysqlPolicyPermissionUpdate], want.Effect, rid, p.URL, p.Method); err != nil {
+					return nil, err
+				}
+
+				change(policyUpdate, policyKindPermission, r.Name, ruleKey(p), want.Effect)
+			}
+
+			delete(rules, ruleKey(p))
+		}
+
+		for _, p := range r.Permissions {
+			if rules[ruleKey(p)] == nil {
+				continue
+			}
+
+			if _, err := tx.Exec(permissionSQLString[mysqlPermissionInstert], p.URL, p.Method, rid, p.Effect); err != nil {
+				return nil, err
+			}
+
+			change(policyAdd, policyKindPermission, r.Name, ruleKey(p), p.Effect)
+		}
+
+		scopes := make(map[string]bool)
+		for _, d := range r.DataScopes {
+			scopes[scopeKey(d)] = true
+		}
+
+		for _, d := range old.DataScopes {
+			if scopes[scopeKey(d)] {
+				delete(scopes, scopeKey(d))
+				continue
+			}
+
+			if _, err := tx.Exec(dataScopeSQLString[mysqlDataScopeDelete], rid, d.Kind, d.Value); err != nil {
+				return nil, err
+			}
+
+			change(policyRemove, policyKindDataScope, r.Name, scopeKey(d), "")
+		}
+
+		for _, d := range r.DataScopes {
+			if !scopes[scopeKey(d)] {
+				continue
+			}
+
+			if _, err := tx.Exec(dataScopeSQLString[mysqlDataScopeInsert], rid, d.Kind, d.Value); err != nil {
+				return nil, err
+			}
+
+			change(policyAdd, policyKindDataScope, r.Name, scopeKey(d), "")
+		}
+
+		grants := make(map[string]*PolicyGrant)
+		for _, g := range r.Admins {
+			if _, exists := state.admins[g.Admin]; !exists {
+				return nil, fmt.Errorf(errFmtPolicyAdminUnknown, g.Admin, r.Name)
+			}
+
+			grants[g.Admin] = g
+		}
+
+		for _, g := range old.Admins {
+			aid := state.admins[g.Admin]
+			want, exists := grants[g.Admin]
+			switch {
+			case !exists:
+				if err := recordRemovedGrants(tx, entry, auditRelationRemove, policySQLString[mysqlPolicySelectRelation], aid, rid); err != nil {
+					return nil, err
+				}
+
+				if _, err := tx.Exec(relationSQLString[mysqlRelationDelete], aid, rid); err != nil {
+					return nil, err
+				}
+
+				if err := bumpVersion(tx, aid); err != nil {
+					return nil, err
+				}
+
+				change(policyRemove, policyKindGrant, r.Name, g.Admin, "")
+			case want.ValidFrom != g.ValidFrom || want.ValidUntil != g.ValidUntil:
+				if _, err := tx.Exec(relationSQLString[mysqlRelationInsert], aid, rid, now, nullable(want.ValidFrom), nullable(want.ValidUntil)); err != nil {
+					return nil, err
+				}
+
+				if err := bumpVersion(tx, aid); err != nil {
+					return nil, err
+				}
+
+				change(policyUpdate, policyKindGrant, r.Name, g.Admin, fmt.Sprintf("valid from %q until %q", want.ValidFrom, want.ValidUntil))
+			}
+
+			delete(grants, g.Admin)
+		}
+
+		for _, g := range r.Admins {
+			if grants[g.Admin] == nil {
+				continue
+			}
+
+			if _, err := tx.Exec(relationSQLString[mysqlRelationInsert], state.admins[g.Admin], rid, now, nullable(g.ValidFrom), nullable(g.ValidUntil)); err != nil {
+				return nil, err
+			}
+
+			if err := bumpVersion(tx, state.admins[g.Admin]); err != nil {
+				return nil, err
+			}
+
+			change(policyAdd, policyKindGrant, r.Name, g.Admin, "")
+		}
+	}
+
+	// the parents are changed after all the roles exist
+	for _, r := range policy.Roles {
+		var (
+			rid     = state.roles[r.Name]
+			parents = make(map[string]bool)
+		)
+
+		for _, parent := range r.Parents {
+			parents[parent] = true
+		}
+
+		if old, exists := current[r.Name]; exists {
+			for _, parent := range old.Parents {
+				if parents[parent] {
+					delete(parents, parent)
+					continue
+				}
+
+				if _, err := tx.Exec(roleParentSQLString[mysqlRoleParentDelete], rid, state.roles[parent]); err != nil {
+					return nil, err
+				}
+
+				change(policyRemove, policyKindParent, r.Name, parent, "")
+			}
+		}
+
+		for _, parent := range r.Parents {
+			if !parents[parent] {
+				continue
+			}
+
+			if _, err := tx.Exec(roleParentSQLString[mysqlRoleParentInsert], rid, state.roles[parent], now); err != nil {
+				return nil, err
+			}
+
+			change(policyAdd, policyKindParent, r.Name, parent, "")
+		}
+	}
+
+	return changes, nil
+}
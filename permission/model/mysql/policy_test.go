@@ -0,0 +1,143 @@
+package mysql
+
+import "testing"
+
+func TestNormalizePolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy *Policy
+		ok     bool
+	}{
+		{"empty", &Policy{Version: PolicyVersion}, true},
+		{"unknown version", &Policy{Version: PolicyVersion + 1}, false},
+		{"role", &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+			{Name: "sales", Permissions: []*PolicyRule{{URL: "/api/v1/order/*"}}},
+		}}, true},
+		{"unnamed role", &Policy{Version: PolicyVersion, Roles: []*PolicyRole{{Name: ""}}}, false},
+		{"duplicate role", &Policy{Version: PolicyVersion, Roles: []*PolicyRole{{Name: "sales"}, {Name: "sales"}}}, false},
+		{"empty url", &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+			{Name: "sales", Permissions: []*PolicyRule{{Method: "GET"}}},
+		}}, false},
+		{"duplicate rule", &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+			{Name: "sales", Permissions: []*PolicyRule{{URL: "/api/v1/order/*"}, {Method: "*", URL: "/api/v1/order/*", Effect: "deny"}}},
+		}}, false},
+		{"invalid effect", &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+			{Name: "sales", Permissions: []*PolicyRule{{URL: "/api/v1/order/*", Effect: "maybe"}}},
+		}}, false},
+		{"data scope", &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+			{Name: "sales", DataScopes: []*PolicyDataScope{{Kind: ScopeOrderUser, Value: 1}, {Kind: ScopeOrderUser, Value: 2}}},
+		}}, true},
+		{"unknown data scope kind", &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+			{Name: "sales", DataScopes: []*PolicyDataScope{{Kind: "order.shop_id", Value: 1}}},
+		}}, false},
+		{"duplicate data scope", &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+			{Name: "sales", DataScopes: []*PolicyDataScope{{Kind: ScopeOrderUser, Value: 1}, {Kind: ScopeOrderUser, Value: 1}}},
+		}}, false},
+		{"parent", &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+			{Name: "staff"}, {Name: "sales", Parents: []string{"staff"}},
+		}}, true},
+		{"unknown parent", &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+			{Name: "sales", Parents: []string{"staff"}},
+		}}, false},
+		{"self parent", &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+			{Name: "sales", Parents: []string{"sales"}},
+		}}, false},
+		{"cycle", &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+			{Name: "staff", Parents: []string{"lead"}}, {Name: "sales", Parents: []string{"staff"}}, {Name: "lead", Parents: []string{"sales"}},
+		}}, false},
+		{"grant", &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+			{Name: "sales", Admins: []*PolicyGrant{{Admin: "root", ValidFrom: "2026-01-01 00:00:00", ValidUntil: "2027-01-01 00:00:00"}}},
+		}}, true},
+		{"grant without admin", &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+			{Name: "sales", Admins: []*PolicyGrant{{}}},
+		}}, false},
+		{"duplicate grant", &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+			{Name: "sales", Admins: []*PolicyGrant{{Admin: "root"}, {Admin: "root"}}},
+		}}, false},
+		{"invalid validity", &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+			{Name: "sales", Admins: []*PolicyGrant{{Admin: "root", ValidUntil: "2027-01-01"}}},
+		}}, false},
+	}
+
+	for _, tt := range tests {
+		if err := normalizePolicy(tt.policy); (err == nil) != tt.ok {
+			t.Errorf("%s: normalizePolicy = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestNormalizePolicyDefaults(t *testing.T) {
+	rule := &PolicyRule{Method: "get", URL: "/api/v1/order/info", Effect: "DENY"}
+	open := &PolicyRule{URL: "/api/v1/order/*"}
+
+	policy := &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+		{Name: "sales", Permissions: []*PolicyRule{rule, open}},
+	}}
+
+	if err := normalizePolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+
+	if rule.Method != "GET" || rule.Effect != EffectDeny {
+		t.Errorf("rule = %s %s, want GET deny", rule.Method, rule.Effect)
+	}
+
+	if open.Method != AnyMethod || open.Effect != EffectAllow {
+		t.Errorf("rule = %s %s, want * allow", open.Method, open.Effect)
+	}
+}
+
+func TestCheckPolicyRules(t *testing.T) {
+	routes := []*Route{
+		{Method: "POST", Path: "/api/v1/order/create", Registered: true},
+		{Method: "POST", Path: "/api/v1/order/:id", Registered: true},
+		{Method: "POST", Path: "/api/v1/banner/create", Registered: false},
+		{Method: AnyMethod, Path: "admin:manage", Registered: true},
+	}
+
+	tests := []struct {
+		name    string
+		rule    *PolicyRule
+		refused bool
+	}{
+		{"route", &PolicyRule{Method: "POST", URL: "/api/v1/order/create"}, false},
+		{"any method", &PolicyRule{Method: AnyMethod, URL: "/api/v1/order/create"}, false},
+		{"pattern", &PolicyRule{Method: AnyMethod, URL: "/api/v1/order/*"}, false},
+		{"named permission", &PolicyRule{Method: AnyMethod, URL: "admin:manage"}, false},
+		{"deny rule", &PolicyRule{Method: "POST", URL: "/api/v1/order/create", Effect: EffectDeny}, false},
+		{"unknown method", &PolicyRule{Method: "FETCH", URL: "/api/v1/order/create"}, true},
+		{"method of no route", &PolicyRule{Method: "GET", URL: "/api/v1/order/create"}, true},
+		{"unknown route", &PolicyRule{Method: "POST", URL: "/api/v1/order/remove/all"}, true},
+		{"unregistered route", &PolicyRule{Method: "POST", URL: "/api/v1/banner/create"}, true},
+		{"unknown named permission", &PolicyRule{Method: AnyMethod, URL: "admin:destroy"}, true},
+	}
+
+	for _, tt := range tests {
+		policy := &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+			{Name: "sales", Permissions: []*PolicyRule{tt.rule}},
+		}}
+
+		if err := normalizePolicy(policy); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if refused := checkPolicyRules(policy, routes); (len(refused) > 0) != tt.refused {
+			t.Errorf("%s: checkPolicyRules = %v, want refused %v", tt.name, refused, tt.refused)
+		}
+	}
+}
+
+func TestCheckPolicyRulesReportsAll(t *testing.T) {
+	policy := &Policy{Version: PolicyVersion, Roles: []*PolicyRole{
+		{Name: "sales", Permissions: []*PolicyRule{{Method: "FETCH", URL: "/a"}, {URL: "/b"}}},
+		{Name: "staff", Permissions: []*PolicyRule{{URL: "/c"}}},
+	}}
+
+	if err := normalizePolicy(policy); err != nil {
+		t.Fatal(err)
+	}
+
+	if refused := checkPolicyRules(policy, nil); len(refused) != 3 {
+		t.Errorf("checkPolicyRules = %v, want 3 refused permissions", refused)
+	}
+}
@@ -2,9 +2,11 @@ package mysql
 
 import (
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/Mictrlan/Miuer/admin/model/mysql"
+	audit "github.com/Mictrlan/Miuer/audit/model/mysql"
 )
 
 // RelationData -
@@ -13,6 +15,28 @@ type (
 		AdminID uint32
 		RoleID  uint32
 	}
+
+	// relationState is the audited state of a grant
+	relationState struct {
+		AdminID    uint32
+		RoleID     uint32
+		ValidFrom  *time.Time
+		ValidUntil *time.Time
+	}
+
+	// Grant is a role granted to an admin regardless of its validity, the empty ValidFrom
+	// and ValidUntil mean unbounded
+	Grant struct {
+		AdminID     uint32
+		AdminName   string
+		AdminActive bool
+		RoleID      uint32
+		RoleName    string
+		RoleActive  bool
+		ValidFrom   string
+		ValidUntil  string
+		CreatedAt   string
+	}
 )
 
 const (
@@ -22,32 +46,75 @@ const (
 	mysqlRelationRoleMap
 	mysqlRelationGetAdminID
 	mysqlRelationGetRoleID
+	mysqlRelationHasWindow
+	mysqlRelationAddWindow
+	mysqlRelationSelectExpired
+	mysqlRelationDeleteExpired
+	mysqlRelationCountAdminID
+	mysqlRelationGetRoleByAdmin
+	mysqlRelationCountRoleByAdmin
 )
 
 var (
+	errInvalidWindow = errors.New("valid_until must be after valid_from and now")
+
 	relationSQLString = []string{
 		`CREATE TABLE IF NOT EXISTS admin.relation (
 			admin_id        BIGINT UNSIGNED NOT NULL,
 			role_id         INT UNSIGNED NOT NULL,
 			created_at      DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			PRIMARY KEY (admin_id,role_id)
+			valid_from      DATETIME NULL DEFAULT NULL,
+			valid_until     DATETIME NULL DEFAULT NULL,
+			PRIMARY KEY (admin_id,role_id),
+			INDEX(valid_until)
 		) ENGINE=InnoDB AUTO_INCREMENT=1000 DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;`,
-		`INSERT INTO admin.relation(admin_id,role_id,created_at) VALUES (?,?,?)`,
+		`INSERT INTO admin.relation(admin_id,role_id,created_at,valid_from,valid_until) VALUES (?,?,?,?,?) ON DUPLICATE KEY UPDATE valid_from = VALUES(valid_from), valid_until = VALUES(valid_until)`,
 		`DELETE FROM admin.relation WHERE admin_id = ? AND role_id = ? LIMIT 1`,
-		`SELECT role_id FROM admin.relation, admin.role WHERE relation.admin_id = ? AND role.active = true AND relation.role_id = role.id LOCK IN SHARE MODE`,
-		`SELECT admin_id FROM admin.user, admin.relation,admin.role WHERE relation.role_id = ? AND role.active = true AND admin.active = true AND relation.admin_id = admin.admin_id LOCK IN SHARE MODE`, // ???
-		`SELECT role_id FROM admin.relation, admin.role WHERE  role.active = true AND relation.role_id = role.id LOCK IN SHARE MODE`,
+		`SELECT role_id FROM admin.relation, admin.role WHERE relation.admin_id = ? AND role.active = true AND relation.role_id = role.id AND (relation.valid_from IS NULL OR relation.valid_from <= ?) AND (relation.valid_until IS NULL OR relation.valid_until > ?) LOCK IN SHARE MODE`,
+		`SELECT relation.admin_id,user.name,user.active,relation.role_id,role.name,role.active,relation.valid_from,relation.valid_until,relation.created_at FROM admin.relation, admin.user, admin.role WHERE relation.role_id = ? AND relation.admin_id = user.id AND relation.role_id = role.id ORDER BY relation.admin_id LIMIT ?,? LOCK IN SHARE MODE`,
+		`SELECT role_id FROM admin.relation, admin.role WHERE  role.active = true AND relation.role_id = role.id AND (relation.valid_from IS NULL OR relation.valid_from <= ?) AND (relation.valid_until IS NULL OR relation.valid_until > ?) LOCK IN SHARE MODE`,
+		`SELECT COUNT(*) FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = 'admin' AND TABLE_NAME = 'relation' AND COLUMN_NAME = 'valid_until'`,
+		`ALTER TABLE admin.relation ADD COLUMN valid_from DATETIME NULL DEFAULT NULL, ADD COLUMN valid_until DATETIME NULL DEFAULT NULL, ADD INDEX(valid_until)`,
+		`SELECT admin_id,role_id,valid_from,valid_until FROM admin.relation WHERE valid_until <= ? FOR UPDATE`,
+		`DELETE FROM admin.relation WHERE valid_until <= ?`,
+		`SELECT COUNT(*) FROM admin.relation, admin.user, admin.role WHERE relation.role_id = ? AND relation.admin_id = user.id AND relation.role_id = role.id LOCK IN SHARE MODE`,
+		`SELECT relation.admin_id,user.name,user.active,relation.role_id,role.name,role.active,relation.valid_from,relation.valid_until,relation.created_at FROM admin.relation, admin.user, admin.role WHERE relation.admin_id = ? AND relation.admin_id = user.id AND relation.role_id = role.id ORDER BY relation.role_id LIMIT ?,? LOCK IN SHARE MODE`,
+		`SELECT COUNT(*) FROM admin.relation, admin.user, admin.role WHERE relation.admin_id = ? AND relation.admin_id = user.id AND relation.role_id = role.id LOCK IN SHARE MODE`,
 	}
 )
 
-// CreateRelationTable create role table.
+// CreateRelationTable create relation table, the validity columns are added to the relation table
+// created before, the existing grants are permanent. The removed grants are in the audit log.
 func CreateRelationTable(db *sql.DB) error {
+	var count int
+
 	_, err := db.Exec(relationSQLString[mysqlRelationCreateTable])
+	if err != nil {
+		return err
+	}
+
+	err = db.QueryRow(relationSQLString[mysqlRelationHasWindow]).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		_, err = db.Exec(relationSQLString[mysqlRelationAddWindow])
+	}
+
 	return err
 }
 
-// AddRelation add a role to admin
-func AddRelation(db *sql.DB, aid, rid uint32) error {
+// AddRelation add a role to admin, the grant is only valid in [validFrom, validUntil),
+// nil means unbounded. Adding an existing grant replaces its validity. entry is recorded in the same transaction.
+func AddRelation(db *sql.DB, aid, rid uint32, validFrom, validUntil *time.Time, entry *audit.Entry) error {
+	defer InvalidateCache()
+
+	now := time.Now()
+	if validUntil != nil && (!validUntil.After(now) || validFrom != nil && !validUntil.After(*validFrom)) {
+		return errInvalidWindow
+	}
+
 	adminIsActive, err := mysql.IsActive(db, aid)
 	if err != nil {
 		return err
@@ -66,20 +133,28 @@ func AddRelation(db *sql.DB, aid, rid uint32) error {
 		return errRoleInactive
 	}
 
-	result, err := db.Exec(relationSQLString[mysqlRelationInsert], aid, rid, time.Now())
-	if err != nil {
-		return err
-	}
+	return audit.Transact(db, entry, func(tx *sql.Tx) error {
+		result, err := tx.Exec(relationSQLString[mysqlRelationInsert], aid, rid, now, validFrom, validUntil)
+		if err != nil {
+			return err
+		}
 
-	if rows, _ := result.RowsAffected(); rows == 0 {
-		return errInvalidMysql
-	}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return errInvalidMysql
+		}
+
+		if err := bumpVersion(tx, aid); err != nil {
+			return err
+		}
 
-	return nil
+		return entry.Describe(auditRelationAdd, auditTargetAdmin, aid).Change(nil, &relationState{AdminID: aid, RoleID: rid, ValidFrom: validFrom, ValidUntil: validUntil})
+	})
 }
 
-// RemoveRelation remove role from admin.
-func RemoveRelation(db *sql.DB, aid, rid uint32) error {
+// RemoveRelation remove role from admin, entry is recorded in the same transaction.
+func RemoveRelation(db *sql.DB, aid, rid uint32, entry *audit.Entry) error {
+	defer InvalidateCache()
+
 	adminIsActive, err := mysql.IsActive(db, aid)
 	if err != nil {
 		return err
@@ -89,11 +164,25 @@ func RemoveRelation(db *sql.DB, aid, rid uint32) error {
 		return errAdminInactive
 	}
 
-	_, err = db.Exec(relationSQLString[mysqlRelationDelete], aid, rid)
-	return err
+	return audit.Transact(db, entry, func(tx *sql.Tx) error {
+		result, err := tx.Exec(relationSQLString[mysqlRelationDelete], aid, rid)
+		if err != nil {
+			return err
+		}
+
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return nil
+		}
+
+		if err := bumpVersion(tx, aid); err != nil {
+			return err
+		}
+
+		return entry.Describe(auditRelationRemove, auditTargetAdmin, aid).Change(&RelationData{AdminID: aid, RoleID: rid}, nil)
+	})
 }
 
-// AssociatedRoleMap list all the roles of the specified admin and the return form is map.
+// AssociatedRoleMap list all the roles of the specified admin in their validity and the roles they inherit, the return form is map.
 func AssociatedRoleMap(db *sql.DB, aid uint32) (map[uint32]bool, error) {
 	var (
 		roleID uint32
@@ -109,7 +198,9 @@ func AssociatedRoleMap(db *sql.DB, aid uint32) (map[uint32]bool, error) {
 		return nil, errAdminInactive
 	}
 
-	rows, err := db.Query(relationSQLString[mysqlRelationRoleMap], aid)
+	now := time.Now()
+
+	rows, err := db.Query(relationSQLString[mysqlRelationRoleMap], aid, now, now)
 	if err != nil {
 		return nil, err
 	}
@@ -123,10 +214,10 @@ func AssociatedRoleMap(db *sql.DB, aid uint32) (map[uint32]bool, error) {
 		result[roleID] = true
 	}
 
-	return result, nil
+	return InheritedRoles(db, result)
 }
 
-// AssociatedRoleList list all the roles of the specified admin and the return form is slice.
+// AssociatedRoleList list all the roles of the specified admin in their validity and the return form is slice.
 func AssociatedRoleList(db *sql.DB, aid uint32) ([]*RelationData, error) {
 	var (
 		roleID uint32
@@ -143,7 +234,9 @@ func AssociatedRoleList(db *sql.DB, aid uint32) ([]*RelationData, error) {
 		return nil, errAdminInactive
 	}
 
-	rows, err := db.Query(relationSQLString[mysqlRelationRoleMap], aid)
+	now := time.Now()
+
+	rows, err := db.Query(relationSQLString[mysqlRelationRoleMap], aid, now, now)
 	if err != nil {
 		return nil, err
 	}
@@ -166,14 +259,16 @@ func AssociatedRoleList(db *sql.DB, aid uint32) ([]*RelationData, error) {
 	return result, nil
 }
 
-// GetAllRoleMap list all the roles of the specified admin and the return form is map.
+// GetAllRoleMap list all the roles assigned to admins in their validity and the return form is map.
 func GetAllRoleMap(db *sql.DB) (map[uint32]bool, error) {
 	var (
 		roleID uint32
 		result = make(map[uint32]bool)
 	)
 
-	rows, err := db.Query(relationSQLString[mysqlRelationGetRoleID])
+	now := time.Now()
+
+	rows, err := db.Query(relationSQLString[mysqlRelationGetRoleID], now, now)
 	if err != nil {
 		return nil, err
 	}
@@ -188,3 +283,94 @@ func GetAllRoleMap(db *sql.DB) (map[uint32]bool, error) {
 	}
 	return result, nil
 }
+
+// SweepExpiredRelations remove the grants whose validity has ended and record an audit entry of
+// the system for each one in the same transaction, the count of removed grants is returned.
+func SweepExpiredRelations(db *sql.DB) (int64, error) {
+	now := time.Now()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = recordRemovedGrants(tx, nil, auditRelationExpire, relationSQLString[mysqlRelationSelectExpired], now)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(versionSQLString[mysqlVersionBumpExpired], now)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec(relationSQLString[mysqlRelationDeleteExpired], now)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows > 0 {
+		InvalidateCache()
+	}
+
+	return rows, nil
+}
+
+// RoleGrants lists the admins holding the role by page and the total count, including the inactive
+// admins and the grants out of their validity.
+func RoleGrants(db *sql.DB, rid, offset, limit uint32) ([]*Grant, uint32, error) {
+	return grants(db, mysqlRelationGetAdminID, mysqlRelationCountAdminID, rid, offset, limit)
+}
+
+// AdminGrants lists the roles granted to the admin by page and the total count, including the
+// inactive roles and the grants out of their validity.
+func AdminGrants(db *sql.DB, aid, offset, limit uint32) ([]*Grant, uint32, error) {
+	return grants(db, mysqlRelationGetRoleByAdmin, mysqlRelationCountRoleByAdmin, aid, offset, limit)
+}
+
+func grants(db *sql.DB, list, count int, id, offset, limit uint32) ([]*Grant, uint32, error) {
+	var (
+		total  uint32
+		result []*Grant
+	)
+
+	err := db.QueryRow(relationSQLString[count], id).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(relationSQLString[list], id, offset, limit)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			g                     Grant
+			validFrom, validUntil sql.NullString
+		)
+
+		if err := rows.Scan(&g.AdminID, &g.AdminName, &g.AdminActive, &g.RoleID, &g.RoleName, &g.RoleActive, &validFrom, &validUntil, &g.CreatedAt); err != nil {
+			return nil, 0, err
+		}
+
+		g.ValidFrom, g.ValidUntil = validFrom.String, validUntil.String
+		result = append(result, &g)
+	}
+
+	return result, total, rows.Err()
+}
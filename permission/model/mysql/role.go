@@ -3,6 +3,8 @@ package mysql
 import (
 	"database/sql"
 	"errors"
+
+	audit "github.com/Mictrlan/Miuer/audit/model/mysql"
 )
 
 type (
@@ -23,12 +25,21 @@ const (
 	mysqlRoleModifyActiveByID
 	mysqlRoleGetList
 	mysqlRoleGetByID
+	mysqlRoleLock
+	mysqlRoleCountReference
+	mysqlRoleSelectRelation
+	mysqlRoleDeleteRelation
+	mysqlRoleDeletePermission
+	mysqlRoleDeleteParent
+	mysqlRoleDeleteDataScope
+	mysqlRoleDelete
 )
 
 var (
 	errInvalidMysql  = errors.New("affected 0 rows")
 	errAdminInactive = errors.New("the admin is not activated")
 	errRoleInactive  = errors.New("the role is not activated")
+	errRoleInUse     = errors.New("the role is still granted, inherited or has permissions or data scopes")
 
 	roleSQLString = []string{
 		`CREATE TABLE IF NOT EXISTS admin.role (
@@ -44,6 +55,14 @@ var (
 		`UPDATE admin.role SET active = ? WHERE id = ? LIMIT 1`,
 		`SELECT * FROM admin.role LOCK IN SHARE MODE`,
 		`SELECT * FROM admin.role WHERE id = ? AND active = true LOCK IN SHARE MODE`,
+		`SELECT id,name,intro,active,create_at FROM admin.role WHERE id = ? FOR UPDATE`,
+		`SELECT (SELECT COUNT(*) FROM admin.relation WHERE role_id = ?) + (SELECT COUNT(*) FROM admin.permission WHERE role_id = ?) + (SELECT COUNT(*) FROM admin.role_parent WHERE role_id = ? OR parent_id = ?) + (SELECT COUNT(*) FROM admin.data_scope WHERE role_id = ?)`,
+		`SELECT admin_id,role_id,valid_from,valid_until FROM admin.relation WHERE role_id = ? FOR UPDATE`,
+		`DELETE FROM admin.relation WHERE role_id = ?`,
+		`DELETE FROM admin.permission WHERE role_id = ?`,
+		`DELETE FROM admin.role_parent WHERE role_id = ? OR parent_id = ?`,
+		`DELETE FROM admin.data_scope WHERE role_id = ?`,
+		`DELETE FROM admin.role WHERE id = ? LIMIT 1`,
 	}
 )
 
@@ -53,30 +72,79 @@ func CreateRoleTable(db *sql.DB) error {
 	return err
 }
 
-// InsertRole insert a new line role information
-func InsertRole(db *sql.DB, name, intro string) error {
-	result, err := db.Exec(roleSQLString[mysqlRoleInsert], name, intro, true)
-	if err != nil {
-		return err
-	}
+// InsertRole insert a new line role information, entry is recorded in the same transaction
+func InsertRole(db *sql.DB, name, intro string, entry *audit.Entry) error {
+	return audit.Transact(db, entry, func(tx *sql.Tx) error {
+		result, err := tx.Exec(roleSQLString[mysqlRoleInsert], name, intro, true)
+		if err != nil {
+			return err
+		}
 
-	if rows, _ := result.RowsAffected(); rows == 0 {
-		return errInvalidMysql
-	}
+		if rows, _ := result.RowsAffected(); rows == 0 {
+			return errInvalidMysql
+		}
 
-	return nil
+		id, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+
+		return entry.Describe(auditRoleCreate, auditTargetRole, id).Change(nil, &Role{ID: uint32(id), Name: name, Intro: intro, Active: true})
+	})
 }
 
-// ModifyRoleByID modify role information by id
-func ModifyRoleByID(db *sql.DB, id uint32, name, intro string) error {
-	_, err := db.Exec(roleSQLString[mysqlRoleModifyByID], name, intro, id)
-	return err
+// ModifyRoleByID modify role information by id, entry is recorded in the same transaction
+func ModifyRoleByID(db *sql.DB, id uint32, name, intro string, entry *audit.Entry) error {
+	return audit.Transact(db, entry, func(tx *sql.Tx) error {
+		before, err := lockRole(tx, id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(roleSQLString[mysqlRoleModifyByID], name, intro, id)
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		after.Name, after.Intro = name, intro
+
+		return entry.Describe(auditRoleModify, auditTargetRole, id).Change(before, &after)
+	})
 }
 
-// ModifyRoleActiveByID modify role active by id
-func ModifyRoleActiveByID(db *sql.DB, id uint32, active bool) error {
-	_, err := db.Exec(roleSQLString[mysqlRoleModifyActiveByID], active, id)
-	return err
+// ModifyRoleActiveByID modify role active by id, entry is recorded in the same transaction
+func ModifyRoleActiveByID(db *sql.DB, id uint32, active bool, entry *audit.Entry) error {
+	defer InvalidateCache()
+
+	return audit.Transact(db, entry, func(tx *sql.Tx) error {
+		before, err := lockRole(tx, id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(roleSQLString[mysqlRoleModifyActiveByID], active, id)
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		after.Active = active
+
+		return entry.Describe(auditRoleActive, auditTargetRole, id).Change(before, &after)
+	})
+}
+
+// lockRole return the role of id whether active or not, the row is locked for update in tx
+func lockRole(tx *sql.Tx, id uint32) (*Role, error) {
+	var r Role
+
+	err := tx.QueryRow(roleSQLString[mysqlRoleLock], id).Scan(&r.ID, &r.Name, &r.Intro, &r.Active, &r.CreateAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &r, nil
 }
 
 // GetRoleList get all role information
@@ -125,3 +193,88 @@ func GetRoleByID(db *sql.DB, id uint32) (*Role, error) {
 
 	return &roler, err
 }
+
+// DeleteRole delete a role. Unless cascade, a role still granted to admins, having permissions or
+// data scopes or in the role inheritance is refused. With cascade, its permissions, data scopes,
+// inheritance and grants are deleted too and the removal of each grant is recorded as made by the actor of entry.
+// entry is recorded in the same transaction.
+func DeleteRole(db *sql.DB, id uint32, cascade bool, entry *audit.Entry) error {
+	var references int
+
+	defer InvalidateCache()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	before, err := lockRole(tx, id)
+	if err != nil {
+		return err
+	}
+
+	if !cascade {
+		err = tx.QueryRow(roleSQLString[mysqlRoleCountReference], id, id, id, id, id).Scan(&references)
+		if err != nil {
+			return err
+		}
+
+		if references > 0 {
+			err = errRoleInUse
+			return err
+		}
+	}
+
+	err = deleteRole(tx, id, entry)
+	if err != nil {
+		return err
+	}
+
+	err = entry.Describe(auditRoleDelete, auditTargetRole, id).Change(before, nil)
+	if err != nil {
+		return err
+	}
+
+	err = audit.Record(tx, entry)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	return err
+}
+
+// deleteRole delete a role with its grants, permissions, data scopes and inheritance in tx, the removal
+// of each grant is recorded as made by the actor of entry
+func deleteRole(tx *sql.Tx, id uint32, entry *audit.Entry) error {
+	err := recordRemovedGrants(tx, entry, auditRelationRemove, roleSQLString[mysqlRoleSelectRelation], id)
+	if err != nil {
+		return err
+	}
+
+	err = bumpRoleVersions(tx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range []int{mysqlRoleDeleteRelation, mysqlRoleDeletePermission, mysqlRoleDeleteDataScope} {
+		_, err = tx.Exec(roleSQLString[stmt], id)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(roleSQLString[mysqlRoleDeleteParent], id, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(roleSQLString[mysqlRoleDelete], id)
+	return err
+}
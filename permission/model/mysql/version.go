@@ -0,0 +1,149 @@
+package mysql
+
+import (
+	"database/sql"
+	"time"
+)
+
+const (
+	mysqlVersionCreateTable = iota
+	mysqlVersionGet
+	mysqlVersionBump
+	mysqlVersionBumpByRole
+	mysqlVersionBumpExpired
+	mysqlVersionGrants
+)
+
+// TokenRoles is the roles granted to an admin for an access token to carry, they are trusted
+// while Version is the permission version of the admin and Until, if any, has not passed
+type TokenRoles struct {
+	Roles   []uint32
+	Version uint64
+	Until   *time.Time
+}
+
+var (
+	versionSQLString = []string{
+		`CREATE TABLE IF NOT EXISTS admin.permission_version (
+			admin_id        BIGINT UNSIGNED NOT NULL,
+			version         BIGINT UNSIGNED NOT NULL DEFAULT 0,
+			PRIMARY KEY (admin_id)
+		) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;`,
+		`SELECT version FROM admin.permission_version WHERE admin_id = ? LOCK IN SHARE MODE`,
+		`INSERT INTO admin.permission_version(admin_id,version) VALUES (?,1) ON DUPLICATE KEY UPDATE version = version + 1`,
+		`INSERT INTO admin.permission_version(admin_id,version) SELECT admin_id,1 FROM admin.relation WHERE role_id = ? ON DUPLICATE KEY UPDATE version = permission_version.version + 1`,
+		`INSERT INTO admin.permission_version(admin_id,version) SELECT admin_id,1 FROM admin.relation WHERE valid_until <= ? ON DUPLICATE KEY UPDATE version = permission_version.version + 1`,
+		`SELECT role_id,valid_from,valid_until FROM admin.relation WHERE admin_id = ? LOCK IN SHARE MODE`,
+	}
+)
+
+// CreateVersionTable create permission version table.
+func CreateVersionTable(db *sql.DB) error {
+	_, err := db.Exec(versionSQLString[mysqlVersionCreateTable])
+	return err
+}
+
+// PermissionVersion return the permission version of admin, it is increased whenever the grants
+// of admin change and is 0 before the first change.
+func PermissionVersion(db *sql.DB, aid uint32) (uint64, error) {
+	var version uint64
+
+	err := db.QueryRow(versionSQLString[mysqlVersionGet], aid).Scan(&version)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+
+	return version, err
+}
+
+// bumpVersion increase the permission version of admin in tx
+func bumpVersion(tx *sql.Tx, aid uint32) error {
+	_, err := tx.Exec(versionSQLString[mysqlVersionBump], aid)
+	return err
+}
+
+// bumpRoleVersions increase the permission versions of the admins granted the role in tx,
+// it must run before the grants are deleted
+func bumpRoleVersions(tx *sql.Tx, rid uint32) error {
+	_, err := tx.Exec(versionSQLString[mysqlVersionBumpByRole], rid)
+	return err
+}
+
+// GetTokenRoles return the roles granted to admin in their validity, the inherited roles are not included
+// so that the changes of role inheritance take effect at once. The version is read first so that a change
+// racing with it leaves an outdated version.
+func GetTokenRoles(db *sql.DB, aid uint32) (*TokenRoles, error) {
+	var (
+		roleID      uint32
+		from, until sql.NullString
+		now         = time.Now()
+		result      = &TokenRoles{Roles: []uint32{}}
+		err         error
+	)
+
+	result.Version, err = PermissionVersion(db, aid)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(versionSQLString[mysqlVersionGrants], aid)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := rows.Scan(&roleID, &from, &until); err != nil {
+			return nil, err
+		}
+
+		validFrom, err := parseDatetime(from)
+		if err != nil {
+			return nil, err
+		}
+
+		validUntil, err := parseDatetime(until)
+		if err != nil {
+			return nil, err
+		}
+
+		// the roles change when a grant starts or ends
+		if validFrom != nil && validFrom.After(now) {
+			result.until(*validFrom)
+			continue
+		}
+
+		if validUntil != nil {
+			if !validUntil.After(now) {
+				continue
+			}
+
+			result.until(*validUntil)
+		}
+
+		result.Roles = append(result.Roles, roleID)
+	}
+
+	return result, rows.Err()
+}
+
+func (t *TokenRoles) until(at time.Time) {
+	if t.Until == nil || at.Before(*t.Until) {
+		t.Until = &at
+	}
+}
+
+// parseDatetime parse a DATETIME column, the driver writes time in UTC without loc in dsn. null is nil
+func parseDatetime(value sql.NullString) (*time.Time, error) {
+	if !value.Valid {
+		return nil, nil
+	}
+
+	t, err := time.ParseInLocation(datetimeLayout, value.String, time.UTC)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
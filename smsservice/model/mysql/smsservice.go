@@ -21,6 +21,7 @@ const (
 	mysqlSmsGetDate
 	mysqlSmsGetCode
 	mysqlSmsDeleteMessage
+	mysqlSmsDeleteByMobile
 )
 
 var smsSQLString = []string{
@@ -36,6 +37,7 @@ var smsSQLString = []string{
 	`SELECT date FROM SMS.msg WHERE sign = ? LOCK IN SHARE MODE`,
 	`SELECT code FROM SMS.msg WHERE sign = ? LOCK IN SHARE MODE`,
 	`DELETE FROM SMS.msg WHERE sign = ? LIMIT 1`,
+	`DELETE FROM SMS.msg WHERE mobile = ? LIMIT 1`,
 }
 
 // CreateDatabase -
@@ -106,6 +108,12 @@ func DeleteSmsMessage(db *sql.DB, sign string) error {
 	return err
 }
 
+// DeleteSmsMessageByMobile remove sms by mobile, e.g. the code sent before a new one
+func DeleteSmsMessageByMobile(db *sql.DB, mobile string) error {
+	_, err := db.Exec(smsSQLString[mysqlSmsDeleteByMobile], mobile)
+	return err
+}
+
 // GetMessageBySign return msg
 func GetMessageBySign(db *sql.DB, sign string) *Message {
 	var msg Message